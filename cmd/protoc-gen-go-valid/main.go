@@ -0,0 +1,180 @@
+// protoc-gen-go-valid 为 protoc 插件, 在生成 xxx.pb.go 的同时根据 proto 源文件注释中的 @tag 注入 tag,
+// 可以替代 protoc --go_out 和 protoc-go-valid 两步操作, 如:
+//
+//	protoc --go-valid_out=paths=source_relative:. xxx.proto
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gitee.com/xuesongtao/protoc-go-valid/file"
+	"gitee.com/xuesongtao/protoc-go-valid/valid"
+	// internal_gengo 为 protoc-gen-go 的实现, 虽然可以导入但不保证兼容, 所以 go.mod 中固定了 protobuf 的版本,
+	// 生成的 xxx.pb.go 和同版本的 protoc-gen-go 一致; 升级时需要确认 GenerateFile/SupportedFeatures 没有变化并更新 protocGenGoVersion
+	gengo "google.golang.org/protobuf/cmd/protoc-gen-go/internal_gengo"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// protocGenGoVersion 生成 xxx.pb.go 使用的 protoc-gen-go 版本, 和 go.mod 中 google.golang.org/protobuf 的版本一致
+const protocGenGoVersion = "v1.28.1"
+
+func main() {
+	if len(os.Args) == 2 && os.Args[1] == "--help" {
+		fmt.Fprintln(os.Stdout, "usage: protoc --go-valid_out=paths=source_relative:. xxx.proto (protoc-gen-go "+protocGenGoVersion+")")
+		os.Exit(0)
+	}
+
+	if err := run(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", filepath.Base(os.Args[0]), err)
+		os.Exit(1)
+	}
+}
+
+// run 读取 CodeGeneratorRequest, 生成 xxx.pb.go 并注入 tag 后输出 CodeGeneratorResponse
+func run(in io.Reader, out io.Writer) error {
+	reqBytes, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	req := new(pluginpb.CodeGeneratorRequest)
+	if err = proto.Unmarshal(reqBytes, req); err != nil {
+		return err
+	}
+
+	resp, err := generate(req)
+	if err != nil {
+		resp = &pluginpb.CodeGeneratorResponse{Error: proto.String(err.Error())}
+	}
+
+	respBytes, err := proto.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(respBytes)
+	return err
+}
+
+// generate 通过 protoc-gen-go 生成 xxx.pb.go, 再根据 proto 注释注入 tag
+func generate(req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+	var (
+		flags               flag.FlagSet
+		companion, validate bool
+		markers             []string
+	)
+	flags.BoolVar(&companion, "companion", false, "不修改 xxx.pb.go, 生成伴生文件 xxx_valid.go 注册规则, 如: companion=true")
+	flags.BoolVar(&validate, "validate", false, "额外生成 xxx_validate.go, 包含不依赖反射的 Validate 方法, 如: validate=true")
+	flags.Func("merge", "key 重复时的合并策略, 如: merge=union, merge=valid:union", func(spec string) error {
+		// protoc 的参数通过逗号隔开, 所以指定 key 时用 ":" 连接
+		return file.SetMergePolicy(strings.ReplaceAll(spec, ":", "="))
+	})
+	flags.Func("marker", "注释中注入 tag 的标识, 可以设置多次, 如: marker=@inject,marker=@valid:valid", func(spec string) error {
+		// protoc 的参数通过逗号隔开, 所以简写的 key 用 ":" 连接
+		markers = append(markers, strings.ReplaceAll(spec, ":", "="))
+		return nil
+	})
+	flags.Func("macro", "规则宏文件, 可以设置多次, 路径相对于执行 protoc 的目录, 如: macro=valid.macro", file.LoadMacroFile)
+	gen, err := protogen.Options{ParamFunc: flags.Set}.New(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(markers) > 0 {
+		if err := file.SetMarkers(markers...); err != nil {
+			return nil, err
+		}
+	}
+
+	filename2Comments := make(map[string]file.FieldComments, len(gen.Files)) // key: 生成的文件名
+	for _, f := range gen.Files {
+		if !f.Generate {
+			continue
+		}
+		gengo.GenerateFile(gen, f)
+		comments := make(file.FieldComments)
+		messageComments(comments, f.Messages)
+		filename2Comments[f.GeneratedFilenamePrefix+".pb.go"] = comments
+	}
+	gen.SupportedFeatures = gengo.SupportedFeatures
+
+	resp := gen.Response()
+	if resp.Error != nil {
+		return resp, nil
+	}
+	genFiles := make([]*pluginpb.CodeGeneratorResponse_File, 0, len(filename2Comments))
+	for _, respFile := range resp.File {
+		comments, ok := filename2Comments[respFile.GetName()]
+		if !ok {
+			continue
+		}
+
+		content := []byte(respFile.GetContent())
+		areas, err := file.ParseSrc(respFile.GetName(), content, comments)
+		if err != nil {
+			return nil, err
+		}
+		if validate {
+			validateContent, err := file.GenValidate(respFile.GetName(), content, areas)
+			if err != nil {
+				return nil, err
+			}
+			genFiles = appendGenFile(genFiles, file.ValidatePath(respFile.GetName()), validateContent)
+		}
+		if companion {
+			companionContent, err := file.GenCompanion(respFile.GetName(), content, areas)
+			if err != nil {
+				return nil, err
+			}
+			genFiles = appendGenFile(genFiles, file.CompanionPath(respFile.GetName()), companionContent)
+			continue
+		}
+		respFile.Content = proto.String(string(file.Inject(content, areas)))
+	}
+	resp.File = append(resp.File, genFiles...)
+	return resp, nil
+}
+
+// appendGenFile 添加生成的文件, 内容为空时跳过
+func appendGenFile(files []*pluginpb.CodeGeneratorResponse_File, name string, content []byte) []*pluginpb.CodeGeneratorResponse_File {
+	if content == nil {
+		return files
+	}
+	return append(files, &pluginpb.CodeGeneratorResponse_File{
+		Name:    proto.String(name),
+		Content: proto.String(string(content)),
+	})
+}
+
+// messageComments 获取 message 中字段的注释, 包含嵌套 message 和 oneof 的包装结构体
+func messageComments(comments file.FieldComments, messages []*protogen.Message) {
+	for _, message := range messages {
+		// 消息的注释用于结构体级别的规则, 如: @valid either(OrderNo,TradeNo)
+		if message.Comments.Leading != "" {
+			comments[message.GoIdent.GoName+"."+valid.StructRuleField] = []string{string(message.Comments.Leading)}
+		}
+		for _, field := range message.Fields {
+			fieldComments := make([]string, 0, 2)
+			for _, comment := range []protogen.Comments{field.Comments.Leading, field.Comments.Trailing} {
+				if comment != "" {
+					fieldComments = append(fieldComments, string(comment))
+				}
+			}
+			if len(fieldComments) == 0 {
+				continue
+			}
+			comments[message.GoIdent.GoName+"."+field.GoName] = fieldComments
+
+			// oneof 字段会生成包装结构体, 如: type Msg_Field struct { Field string }
+			if field.Oneof != nil && !field.Oneof.Desc.IsSynthetic() {
+				comments[field.GoIdent.GoName+"."+field.GoName] = fieldComments
+			}
+		}
+		messageComments(comments, message.Messages)
+	}
+}
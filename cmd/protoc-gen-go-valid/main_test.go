@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"gitee.com/xuesongtao/protoc-go-valid/file"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// testRequest 模拟 protoc 对 test/test.proto 生成的请求
+func testRequest() *pluginpb.CodeGeneratorRequest {
+	fd := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test/test.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		Options: &descriptorpb.FileOptions{GoPackage: proto.String("gitee.com/xuesongtao/protoc-go-valid/test")},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Man"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{
+						Name:     proto.String("name"),
+						JsonName: proto.String("name"),
+						Number:   proto.Int32(1),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					},
+					{
+						Name:     proto.String("age"),
+						JsonName: proto.String("age"),
+						Number:   proto.Int32(2),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(),
+					},
+				},
+			},
+		},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{
+			Location: []*descriptorpb.SourceCodeInfo_Location{
+				{Path: []int32{4, 0}, Span: []int32{0, 0, 10}, LeadingComments: proto.String(" @valid either(Name,Age)\n")},
+				{Path: []int32{4, 0, 2, 0}, Span: []int32{1, 0, 10}, TrailingComments: proto.String(` 姓名 @tag valid:"required"`)},
+				{Path: []int32{4, 0, 2, 1}, Span: []int32{2, 0, 10}, TrailingComments: proto.String(" 年龄")},
+			},
+		},
+	}
+	return &pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{"test/test.proto"},
+		Parameter:      proto.String("paths=source_relative"),
+		ProtoFile:      []*descriptorpb.FileDescriptorProto{fd},
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	resp, err := generate(testRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != nil {
+		t.Fatal(resp.GetError())
+	}
+	if len(resp.File) != 1 || resp.File[0].GetName() != "test/test.pb.go" {
+		t.Fatalf("resp files is not ok: %v", resp.File)
+	}
+
+	content := resp.File[0].GetContent()
+	// internal_gengo 不保证兼容, 升级 protobuf 时需要确认生成的内容并更新 protocGenGoVersion
+	if !strings.Contains(content, "// \tprotoc-gen-go "+protocGenGoVersion+"\n") {
+		t.Errorf("protoc-gen-go version is not %s", protocGenGoVersion)
+	}
+	if !strings.Contains(content, `json:"name,omitempty" valid:"required"`+"`") {
+		t.Error("name is not injected")
+	}
+	if strings.Contains(content, `json:"age,omitempty" valid`) {
+		t.Error("age should not injected")
+	}
+	if !strings.Contains(content, "_    struct{} `valid:\"either(Name,Age)\"`") {
+		t.Error("struct rule is not injected")
+	}
+}
+
+func TestGenerateCompanion(t *testing.T) {
+	req := testRequest()
+	req.Parameter = proto.String("paths=source_relative,companion=true")
+	resp, err := generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != nil {
+		t.Fatal(resp.GetError())
+	}
+	if len(resp.File) != 2 || resp.File[1].GetName() != "test/test_valid.go" {
+		t.Fatalf("resp files is not ok: %v", resp.File)
+	}
+
+	// xxx.pb.go 保持不变
+	if strings.Contains(resp.File[0].GetContent(), `valid:"required"`+"`") {
+		t.Error("pb.go should not be injected")
+	}
+	if content := resp.File[1].GetContent(); !strings.Contains(content, `"Name": "required",`) || !strings.Contains(content, `"_":    "either(Name,Age)",`) {
+		t.Error(content)
+	}
+}
+
+func TestGenerateValidate(t *testing.T) {
+	req := testRequest()
+	req.Parameter = proto.String("paths=source_relative,validate=true")
+	resp, err := generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != nil {
+		t.Fatal(resp.GetError())
+	}
+	if len(resp.File) != 2 || resp.File[1].GetName() != "test/test_validate.go" {
+		t.Fatalf("resp files is not ok: %v", resp.File)
+	}
+
+	// xxx.pb.go 仍然会注入
+	if !strings.Contains(resp.File[0].GetContent(), `valid:"required"`+"`") {
+		t.Error(resp.File[0].GetContent())
+	}
+	if content := resp.File[1].GetContent(); !strings.Contains(content, "func (m *Man) Validate() error {") {
+		t.Error(content)
+	}
+}
+
+func TestGenerateMarker(t *testing.T) {
+	defer file.SetMarkers(file.InjectTagFlag)
+
+	req := testRequest()
+	req.Parameter = proto.String("paths=source_relative,marker=@inject,marker=@v:valid")
+	req.ProtoFile[0].SourceCodeInfo.Location[1].TrailingComments = proto.String(` 姓名 @inject valid:"required"`)
+	req.ProtoFile[0].SourceCodeInfo.Location[2].TrailingComments = proto.String(" 年龄 @v ge=1")
+	resp, err := generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != nil {
+		t.Fatal(resp.GetError())
+	}
+	content := resp.File[0].GetContent()
+	if !strings.Contains(content, `valid:"required"`+"`") || !strings.Contains(content, `valid:"ge=1"`+"`") {
+		t.Error(content)
+	}
+}
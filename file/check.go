@@ -0,0 +1,69 @@
+package file
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"gitee.com/xuesongtao/protoc-go-valid/valid"
+)
+
+const (
+	validTagKey = "valid" // 验证器使用的 tag key
+)
+
+var (
+	// 自定义的验证名白名单, 运行时通过 valid.SetCustomerValidFn 或 SetValidFn 设置的验证不在注入工具中
+	allowValidNames = make(map[string]bool)
+)
+
+// SetAllowValidNames 设置自定义的验证名白名单, 校验时白名单中的验证名视为存在
+func SetAllowValidNames(validNames ...string) {
+	for _, validName := range validNames {
+		validName = strings.TrimSpace(validName)
+		if validName == "" {
+			continue
+		}
+		allowValidNames[validName] = true
+	}
+}
+
+// CheckValid 校验待注入 tag 中 valid 的规则是否存在, 解析方式和验证器一致
+func (a TextArea) CheckValid() error {
+	for _, item := range newTagItems(a.InjectTag) {
+		if item.key != validTagKey {
+			continue
+		}
+
+		validNames, err := strconv.Unquote(item.value)
+		if err != nil {
+			return errors.New("valid value " + item.value + " is not quoted correctly")
+		}
+
+		// 结构体级别的规则
+		if a.FieldName == valid.StructRuleField {
+			for _, rule := range valid.StructRulesSplit(validNames) {
+				if _, _, err := valid.ParseStructRule(rule); err != nil {
+					return errors.New("struct rule " + strconv.Quote(rule) + " is not ok, it should be like either(OrderNo,TradeNo) or botheq(Pwd,RePwd)")
+				}
+			}
+			continue
+		}
+
+		notExist := make([]string, 0, 1)
+		for _, validName := range valid.ValidNamesSplit(validNames) {
+			if validName == "" {
+				continue
+			}
+			key, _, _ := valid.ParseValidNameKV(validName)
+			if valid.ExistValidName(key) || allowValidNames[key] {
+				continue
+			}
+			notExist = append(notExist, strconv.Quote(key))
+		}
+		if len(notExist) > 0 {
+			return errors.New("valid " + strings.Join(notExist, ", ") + " is not exist")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package file
+
+import "testing"
+
+func TestCheckValid(t *testing.T) {
+	area := TextArea{InjectTag: `json:"name" valid:"required|必填,to=1~3,he"`}
+	if err := area.CheckValid(); err == nil || err.Error() != `valid "he" is not exist` {
+		t.Error(err)
+	}
+
+	SetAllowValidNames("he")
+	defer delete(allowValidNames, "he")
+	if err := area.CheckValid(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,192 @@
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gitee.com/xuesongtao/protoc-go-valid/valid"
+)
+
+const (
+	companionSuffix = "_valid.go"                                            // 伴生文件的后缀
+	genHeader       = "// Code generated by protoc-go-valid. DO NOT EDIT.\n" // 生成文件的头部, 用于判断文件是否为本工具生成
+	validPkgPath    = "gitee.com/xuesongtao/protoc-go-valid/valid"           // 验证器的包路径
+)
+
+// IsGenFile 判断是否为本工具生成的文件, 即以生成文件头部开始的 xxx_valid.go 或 xxx_validate.go
+// 手写的同名文件不是生成的, 仍然需要处理
+func IsGenFile(filename string) bool {
+	if !strings.HasSuffix(filename, companionSuffix) && !strings.HasSuffix(filename, validateSuffix) {
+		return false
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, len(genHeader))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+	return string(header) == genHeader
+}
+
+// CompanionPath 获取伴生文件的路径, 如: xxx.pb.go => xxx_valid.go
+func CompanionPath(inputPath string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(inputPath, ".go"), ".pb") + companionSuffix
+}
+
+// structRule 结构体的规则
+type structRule struct {
+	name  string
+	rules [][2]string // 字段名和规则, 保持字段的顺序
+}
+
+// GenCompanion 生成伴生文件的内容, 在 init 中通过 valid.SetGlobalRule 注册每个结构体的规则, 不会修改源文件
+// 规则为注入后 valid 的最终值, 所以验证结果和注入 tag 一致; 匿名结构体和函数内的结构体无法引用, 会跳过
+// src 为 nil 时会读取 filename 的内容, 没有需要注册的规则时返回 nil
+func GenCompanion(filename string, src []byte, areas []TextArea) ([]byte, error) {
+	f, err := parseSrcFile(token.NewFileSet(), filename, src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// 只有顶层声明的结构体才能引用
+	topStructs := make(map[string]bool)
+	for _, typeSpec := range topTypeSpecs(f) {
+		if _, ok := typeSpec.Type.(*ast.StructType); ok {
+			topStructs[typeSpec.Name.Name] = true
+		}
+	}
+
+	structRules := make([]*structRule, 0, 4)
+	name2Rule := make(map[string]*structRule)
+	for _, area := range areas {
+		if !topStructs[area.StructName] {
+			continue
+		}
+		rules := reflect.StructTag(area.FinalTag()).Get(validTagKey)
+		if rules == "" {
+			// 注入后没有规则时(如: @tag-remove valid), 需要注册为没有规则, 才能忽略原 tag 中的规则
+			if reflect.StructTag(area.CurrentTag).Get(validTagKey) == "" {
+				continue
+			}
+			rules = valid.NoRule
+		}
+		rule, ok := name2Rule[area.StructName]
+		if !ok {
+			rule = &structRule{name: area.StructName}
+			name2Rule[area.StructName] = rule
+			structRules = append(structRules, rule)
+		}
+		for _, name := range area.FieldNames {
+			rule.rules = append(rule.rules, [2]string{name, rules})
+		}
+	}
+	if len(structRules) == 0 {
+		return nil, nil
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString(genHeader)
+	fmt.Fprintf(buf, "// source: %s\n\n", filepath.Base(filename))
+	fmt.Fprintf(buf, "package %s\n\n", f.Name.Name)
+	fmt.Fprintf(buf, "import %q\n\n", validPkgPath)
+	buf.WriteString("func init() {\n")
+	for _, rule := range structRules {
+		buf.WriteString("valid.SetGlobalRule(valid.RM{\n")
+		for _, fieldRule := range rule.rules {
+			value := strconv.Quote(fieldRule[1])
+			if fieldRule[1] == valid.NoRule {
+				value = "valid.NoRule"
+			}
+			fmt.Fprintf(buf, "%s: %s,\n", strconv.Quote(fieldRule[0]), value)
+		}
+		fmt.Fprintf(buf, "}, (*%s)(nil))\n", rule.name)
+	}
+	buf.WriteString("}\n")
+	return format.Source(buf.Bytes())
+}
+
+// WriteCompanion 生成伴生文件, 内容没有变化时不写文件, 没有规则时会删除已有的伴生文件
+func WriteCompanion(inputPath string, areas []TextArea) (isChanged bool, err error) {
+	contents, err := GenCompanion(inputPath, nil, areas)
+	if err != nil {
+		return
+	}
+	return writeGenFile(CompanionPath(inputPath), contents)
+}
+
+// DiffCompanion 获取伴生文件生成前后的 unified diff, 不写文件, 没有变化时 diff 为空
+func DiffCompanion(inputPath string, areas []TextArea) (diff string, err error) {
+	contents, err := GenCompanion(inputPath, nil, areas)
+	if err != nil {
+		return
+	}
+	return diffGenFile(CompanionPath(inputPath), contents)
+}
+
+// checkGenFile 已有的文件必须是本工具生成的, 避免覆盖或删除手写的同名文件
+func checkGenFile(genPath string, old []byte) error {
+	if !bytes.HasPrefix(old, []byte(genHeader)) {
+		return fmt.Errorf("%q is not generated by protoc-go-valid, it will not be overwritten or removed", genPath)
+	}
+	return nil
+}
+
+// writeGenFile 写生成的文件, 内容没有变化时不写文件, contents 为 nil 时会删除已有的文件
+// 已有的文件不是本工具生成的时候会报错
+func writeGenFile(genPath string, contents []byte) (isChanged bool, err error) {
+	perm := os.FileMode(0644)
+	info, err := os.Stat(genPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return
+		}
+		err = nil
+		if contents == nil {
+			return
+		}
+		return true, writeFileAtomic(genPath, contents, perm)
+	}
+
+	old, err := ReadFile(genPath)
+	if err != nil {
+		return
+	}
+	if err = checkGenFile(genPath, old); err != nil {
+		return
+	}
+	if contents == nil {
+		return true, os.Remove(genPath)
+	}
+	if bytes.Equal(old, contents) {
+		return
+	}
+	return true, writeFileAtomic(genPath, contents, info.Mode().Perm())
+}
+
+// diffGenFile 获取生成的文件写入前后的 unified diff
+func diffGenFile(genPath string, contents []byte) (diff string, err error) {
+	old, err := ReadFile(genPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return
+		}
+		err = nil
+	} else if err = checkGenFile(genPath, old); err != nil {
+		return
+	}
+	diff = Diff(strings.TrimPrefix(filepath.ToSlash(filepath.Clean(genPath)), "/"), old, contents)
+	return
+}
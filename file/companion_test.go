@@ -0,0 +1,108 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenCompanion(t *testing.T) {
+	if got := CompanionPath("test/test.pb.go"); got != "test/test_valid.go" {
+		t.Error(got)
+	}
+
+	src := []byte("package test\n\n" +
+		"// @valid either(Name,Phone)\n" +
+		"type Man struct {\n" +
+		"\tName  string `json:\"name\" valid:\"required\"` // @tag-append valid:\"to=1~3\"\n" +
+		"\tPhone string // @tag valid:\"phone\"\n" +
+		"\tAge   int    // @tag json:\"age\"\n" +
+		"\tA, B  string // @tag valid:\"required\"\n" +
+		"\tInner struct {\n" +
+		"\t\tNo string // @tag valid:\"required\"\n" +
+		"\t}\n" +
+		"}\n")
+	areas, err := ParseSrc("test.pb.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := GenCompanion("test.pb.go", src, areas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sure := "// Code generated by protoc-go-valid. DO NOT EDIT.\n" +
+		"// source: test.pb.go\n\n" +
+		"package test\n\n" +
+		"import \"gitee.com/xuesongtao/protoc-go-valid/valid\"\n\n" +
+		"func init() {\n" +
+		"\tvalid.SetGlobalRule(valid.RM{\n" +
+		"\t\t\"Name\":  \"required,to=1~3\",\n" +
+		"\t\t\"Phone\": \"phone\",\n" +
+		"\t\t\"A\":     \"required\",\n" +
+		"\t\t\"B\":     \"required\",\n" +
+		"\t\t\"_\":     \"either(Name,Phone)\",\n" +
+		"\t}, (*Man)(nil))\n" +
+		"}\n"
+	if string(got) != sure {
+		t.Error(string(got))
+	}
+
+	// 删除 valid 后注册为没有规则, 忽略原 tag 中的规则
+	src = []byte("package test\n\n" +
+		"type Man struct {\n" +
+		"\tName string `valid:\"required\"` // @tag-remove valid\n" +
+		"\tAge  int    // @tag-remove valid\n" +
+		"}\n")
+	if areas, err = ParseSrc("test.pb.go", src); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = GenCompanion("test.pb.go", src, areas); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "\"Name\": valid.NoRule,") || strings.Contains(string(got), "Age") {
+		t.Error(string(got))
+	}
+
+	// 没有规则时不生成
+	if got, err = GenCompanion("test.pb.go", []byte("package test\n"), nil); err != nil || got != nil {
+		t.Errorf("got: %s, err: %v", got, err)
+	}
+}
+
+func TestWriteCompanion(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "user.go")
+	companionPath := CompanionPath(filename)
+	if err := ioutil.WriteFile(filename, []byte("package test\n\ntype User struct {\n\tName string\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 手写的同名文件不会被删除或覆盖
+	handWritten := []byte("package test\n\nfunc hello() {}\n")
+	if err := ioutil.WriteFile(companionPath, handWritten, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WriteCompanion(filename, nil); err == nil {
+		t.Error("it should be failed")
+	}
+	if _, err := DiffCompanion(filename, nil); err == nil {
+		t.Error("it should be failed")
+	}
+	if got, err := ioutil.ReadFile(companionPath); err != nil || string(got) != string(handWritten) {
+		t.Errorf("got: %s, err: %v", got, err)
+	}
+
+	// 生成的文件没有规则时会删除
+	if err := ioutil.WriteFile(companionPath, []byte(genHeader+"\npackage test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	isChanged, err := WriteCompanion(filename, nil)
+	if err != nil || !isChanged {
+		t.Errorf("isChanged: %v, err: %v", isChanged, err)
+	}
+	if _, err := os.Stat(companionPath); !os.IsNotExist(err) {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,205 @@
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	diffContextLines = 3 // diff 上下文行数
+)
+
+// diffLine 行差异
+type diffLine struct {
+	op   byte // ' ': 相同, '-': 删除, '+': 新增
+	text string
+}
+
+// splitLines 按行分割, 每行保留换行符
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines 通过 Myers 算法计算两段内容的行差异
+func diffLines(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+2)
+	trace := make([][]int, 0, 8)
+
+	// 找到最短编辑路径
+	var done bool
+	for d := 0; d <= max && !done; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // 向下, 新增
+			} else {
+				x = v[offset+k-1] + 1 // 向右, 删除
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+	}
+
+	// 回溯得到编辑脚本
+	res := make([]diffLine, 0, n+m)
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			res = append(res, diffLine{op: ' ', text: a[x]})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			res = append(res, diffLine{op: '+', text: b[y]})
+		} else {
+			x--
+			res = append(res, diffLine{op: '-', text: a[x]})
+		}
+	}
+
+	// 反转
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res
+}
+
+// Diff 生成 unified diff 格式的差异内容, 没有差异的时候返回空
+func Diff(name string, oldContents, newContents []byte) string {
+	if bytes.Equal(oldContents, newContents) {
+		return ""
+	}
+	lines := diffLines(splitLines(string(oldContents)), splitLines(string(newContents)))
+
+	// 标记有变化的行
+	var hasChange bool
+	for _, line := range lines {
+		if line.op != ' ' {
+			hasChange = true
+			break
+		}
+	}
+	if !hasChange {
+		return ""
+	}
+
+	buf := new(strings.Builder)
+	buf.WriteString("--- a/" + name + "\n")
+	buf.WriteString("+++ b/" + name + "\n")
+
+	// 按 hunk 输出
+	l := len(lines)
+	for i := 0; i < l; {
+		// 找到下一个变化的行
+		for i < l && lines[i].op == ' ' {
+			i++
+		}
+		if i == l {
+			break
+		}
+
+		// hunk 的起止, 相邻变化之间相同的行不超过 2*diffContextLines 时合并为一个 hunk
+		start := i - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < l {
+			if lines[end].op != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < l && lines[next].op == ' ' {
+				next++
+			}
+			if next == l || next-end > 2*diffContextLines {
+				break
+			}
+			end = next
+		}
+		end += diffContextLines
+		if end > l {
+			end = l
+		}
+
+		writeHunk(buf, lines, start, end)
+		i = end
+	}
+	return buf.String()
+}
+
+// writeHunk 输出 lines[start:end] 为一个 hunk
+func writeHunk(buf *strings.Builder, lines []diffLine, start, end int) {
+	// 计算 hunk 在新旧内容中的起始行号
+	oldStart, newStart := 1, 1
+	for _, line := range lines[:start] {
+		if line.op != '+' {
+			oldStart++
+		}
+		if line.op != '-' {
+			newStart++
+		}
+	}
+	var oldCount, newCount int
+	for _, line := range lines[start:end] {
+		if line.op != '+' {
+			oldCount++
+		}
+		if line.op != '-' {
+			newCount++
+		}
+	}
+	// 范围为空时, 起始行号为前一行
+	if oldCount == 0 {
+		oldStart--
+	}
+	if newCount == 0 {
+		newStart--
+	}
+
+	fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+	for _, line := range lines[start:end] {
+		buf.WriteByte(line.op)
+		buf.WriteString(line.text)
+		if !strings.HasSuffix(line.text, "\n") {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package file
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	t.Run("no change", func(t *testing.T) {
+		src := []byte("package test\n")
+		if diff := Diff("test.go", src, src); diff != "" {
+			t.Error(diff)
+		}
+		if diff := Diff("test.go", []byte{}, []byte{}); diff != "" {
+			t.Error(diff)
+		}
+		if diff := Diff("test.go", nil, nil); diff != "" {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("change", func(t *testing.T) {
+		old := []byte("package test\n\ntype Man struct {\n\tName string `json:\"name\"`\n}\n")
+		new := []byte("package test\n\ntype Man struct {\n\tName string `json:\"name\" valid:\"required\"`\n}\n")
+		sure := "--- a/test.go\n" +
+			"+++ b/test.go\n" +
+			"@@ -1,5 +1,5 @@\n" +
+			" package test\n" +
+			" \n" +
+			" type Man struct {\n" +
+			"-\tName string `json:\"name\"`\n" +
+			"+\tName string `json:\"name\" valid:\"required\"`\n" +
+			" }\n"
+		if diff := Diff("test.go", old, new); diff != sure {
+			t.Error(diff)
+		}
+	})
+}
@@ -1,13 +1,29 @@
 package file
 
 import (
-	"fmt"
+	"strconv"
 	"strings"
+
+	"gitee.com/xuesongtao/protoc-go-valid/valid"
+)
+
+const (
+	directiveRemove = "remove" // 删除 tag
+	directiveRename = "rename" // 重命名 tag 的 key
 )
 
+// tagItem tag 中的一项, 如: json:"name,omitempty"
 type tagItem struct {
-	key   string
-	value string
+	key   string // 为空时, value 为无法按 reflect.StructTag 规范解析的原始内容
+	value string // 带双引号的原始值, 保持原有的转义
+}
+
+// String
+func (t tagItem) String() string {
+	if t.key == "" {
+		return t.value
+	}
+	return t.key + ":" + t.value
 }
 
 type tagItems []tagItem
@@ -15,68 +31,333 @@ type tagItems []tagItem
 func (t tagItems) format() string {
 	tags := []string{}
 	for _, item := range t {
-		tags = append(tags, fmt.Sprintf(`%s:%s`, item.key, item.value))
+		tags = append(tags, item.String())
 	}
 	return strings.Join(tags, " ")
 }
 
-// override 重写, 将输入的与现在的进行合并
-func (t tagItems) override(inTags tagItems) tagItems {
-	overridEd := []tagItem{}
+// equal 判断两者是否相同
+func (t tagItems) equal(other tagItems) bool {
+	if len(t) != len(other) {
+		return false
+	}
 	for i := range t {
-		var dup = -1
-		for j := range inTags {
-			if t[i].key == inTags[j].key {
-				dup = j
-				break
-			}
-		}
-		if dup == -1 {
-			overridEd = append(overridEd, t[i])
-		} else {
-			overridEd = append(overridEd, inTags[dup])
-			inTags = append(inTags[:dup], inTags[dup+1:]...)
+		if t[i] != other[i] {
+			return false
 		}
 	}
-	return append(overridEd, inTags...)
+	return true
 }
 
-// newTagItems
+// newTagItems 按 reflect.StructTag 的规范解析 tag
+// key 为除空格, 引号, 冒号和控制字符外的任意字符, value 为 Go 的双引号字符串(支持转义和空值)
+// 无法解析的剩余内容会原样保留
 func newTagItems(tag string) tagItems {
 	items := []tagItem{}
-	splitted := rTags.FindAllString(tag, -1)
+	for tag != "" {
+		// 跳过前面的空格
+		i := 0
+		for i < len(tag) && tag[i] == ' ' {
+			i++
+		}
+		tag = tag[i:]
+		if tag == "" {
+			break
+		}
 
-	// fmt.Println("splitted: ", splitted)
-	for _, t := range splitted {
-		sepPos := strings.Index(t, ":")
-		items = append(items, tagItem{
-			key:   t[:sepPos],
-			value: t[sepPos+1:],
-		})
+		// 解析 key
+		i = 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 || i+1 >= len(tag) || tag[i] != ':' || tag[i+1] != '"' {
+			break
+		}
+		key := tag[:i]
+		tag = tag[i+1:]
+
+		// 解析带双引号的 value
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(tag) {
+			tag = key + ":" + tag
+			break
+		}
+		items = append(items, tagItem{key: key, value: tag[:i+1]})
+		tag = tag[i+1:]
+	}
+
+	// 无法解析的内容原样保留
+	if tag = strings.TrimSpace(tag); tag != "" {
+		items = append(items, tagItem{value: tag})
 	}
 	return items
 }
 
 // injectTag 注入 tag
-func injectTag(contents []byte, area textArea) (injected []byte) {
-	expr := make([]byte, area.End-area.Start)
-	copy(expr, contents[area.Start-1:area.End-1])
-	oldTag := newTagItems(area.CurrentTag)   // 原来的 tag
-	injectTag := newTagItems(area.InjectTag) // 待注入的 tag
-	finalTag := oldTag.override(injectTag)
-	expr = rInject.ReplaceAll(expr, []byte(fmt.Sprintf("`%s`", finalTag.format())))
-	injected = append(injected, contents[:area.Start-1]...)
-	injected = append(injected, expr...)
+// 字段已有 tag 时 [Start, End) 为 tag 所在位置, 会进行替换; 没有 tag 时 Start 等于 End, 为字段类型的末尾, 会新增 tag
+func injectTag(contents []byte, area TextArea) (injected []byte) {
+	oldTag := newTagItems(area.CurrentTag) // 原来的 tag
+	finalItems := area.finalItems(oldTag)
+	if oldTag.equal(finalItems) { // 没有变化保持原样
+		return contents
+	}
+
+	start := area.Start - 1
+	var finalTag string
+	if area.IsNewField {
+		finalTag = newStructRuleField(contents, start, finalItems)
+	} else if len(finalItems) > 0 {
+		finalTag = quoteTag(finalItems.format())
+		if !area.HasTag {
+			finalTag = " " + finalTag
+		}
+	} else { // 全部删除时去掉 tag 和前面的空白
+		for start > 0 && (contents[start-1] == ' ' || contents[start-1] == '\t') {
+			start--
+		}
+	}
+
+	injected = make([]byte, 0, len(contents)+len(finalTag))
+	injected = append(injected, contents[:start]...)
+	injected = append(injected, finalTag...)
 	injected = append(injected, contents[area.End-1:]...)
 	return
 }
 
-// tagFromComment 配注释中的注入 tag
-func tagFromComment(comment string) (tag string) {
-	match := rComment.FindStringSubmatch(comment)
-	// fmt.Printf("comment: %s, match: %v\n", comment, match)
-	if len(match) == 2 {
-		tag = match[1]
+// newStructRuleField 生成结构体级别规则的字段, 如: _ struct{} `valid:"either(OrderNo,TradeNo)"`
+// start 为结构体 } 的位置, 如果 } 前面不是换行就先换行
+func newStructRuleField(contents []byte, start int, finalItems tagItems) string {
+	field := valid.StructRuleField + " struct{} " + quoteTag(finalItems.format()) + "\n"
+	i := start
+	for i > 0 && (contents[i-1] == ' ' || contents[i-1] == '\t') {
+		i--
+	}
+	if i > 0 && contents[i-1] != '\n' {
+		field = "\n" + field
+	}
+	return field
+}
+
+// quoteTag 将 tag 用反引号包裹, 如果 tag 中包含反引号就使用双引号
+func quoteTag(tag string) string {
+	if strings.Contains(tag, "`") {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
+
+// finalItems 计算最终的 tag, 顺序为: 删除 -> 重命名 -> 注入
+func (a TextArea) finalItems(oldTag tagItems) tagItems {
+	finalItems := oldTag
+	if len(a.RemoveTags) > 0 {
+		finalItems = finalItems.remove(newRemoveItems(a.RemoveTags))
+	}
+	if len(a.RenameTags) > 0 {
+		finalItems = finalItems.rename(a.RenameTags)
+	}
+	return finalItems.merge(newTagItems(a.InjectTag), a.Policies)
+}
+
+// IsInjected 判断待注入的 tag 是否已经体现在已有 tag 中
+func (a TextArea) IsInjected() bool {
+	oldTag := newTagItems(a.CurrentTag)
+	return oldTag.equal(a.finalItems(oldTag))
+}
+
+// FinalTag 获取注入后最终的 tag 内容
+func (a TextArea) FinalTag() string {
+	return a.finalItems(newTagItems(a.CurrentTag)).format()
+}
+
+// remove 删除 tag, value 为空时删除整个 key, 否则删除 key 中对应规则名的规则
+func (t tagItems) remove(removeItems tagItems) tagItems {
+	res := make(tagItems, 0, len(t))
+	for _, item := range t {
+		var isDel bool
+		for _, removeItem := range removeItems {
+			if item.key == "" || item.key != removeItem.key {
+				continue
+			}
+			if removeItem.value == "" {
+				isDel = true
+				break
+			}
+			item = removeRules(item, removeItem)
+		}
+		if !isDel {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// removeRules 删除 item 中和 removeItem 规则名相同的规则
+func removeRules(item, removeItem tagItem) tagItem {
+	val, err1 := strconv.Unquote(item.value)
+	removeVal, err2 := strconv.Unquote(removeItem.value)
+	if err1 != nil || err2 != nil {
+		return item
+	}
+
+	removeNames := make(map[string]bool)
+	for _, rule := range valid.ValidNamesSplit(removeVal) {
+		name, _, _ := valid.ParseValidNameKV(rule)
+		removeNames[name] = true
+	}
+	rules := make([]string, 0, 2)
+	for _, rule := range valid.ValidNamesSplit(val) {
+		if name, _, _ := valid.ParseValidNameKV(rule); !removeNames[name] {
+			rules = append(rules, rule)
+		}
+	}
+	return tagItem{key: item.key, value: strconv.Quote(strings.Join(rules, ","))}
+}
+
+// rename 重命名 key, 新 key 已存在时会被替换
+func (t tagItems) rename(renames map[string]string) tagItems {
+	newKeys := make(map[string]bool, len(renames))
+	for _, newKey := range renames {
+		newKeys[newKey] = true
+	}
+
+	res := make(tagItems, 0, len(t))
+	for _, item := range t {
+		if item.key == "" {
+			res = append(res, item)
+			continue
+		}
+		if newKey, ok := renames[item.key]; ok {
+			item.key = newKey
+		} else if newKeys[item.key] {
+			continue
+		}
+		res = append(res, item)
+	}
+	return res
+}
+
+// newRemoveItems 解析待删除的 tag, 如: json protobuf_oneof json:"omitempty"
+func newRemoveItems(removeTags []string) tagItems {
+	items := make(tagItems, 0, len(removeTags))
+	for _, removeTag := range removeTags {
+		index := strings.Index(removeTag, ":")
+		if index == -1 {
+			items = append(items, tagItem{key: removeTag})
+			continue
+		}
+		items = append(items, tagItem{key: removeTag[:index], value: removeTag[index+1:]})
+	}
+	return items
+}
+
+// commentTag 注释中待注入的 tag
+type commentTag struct {
+	directive string      // 指令, 为空时为注入, 如: @tag-remove, @tag-rename
+	policy    MergePolicy // 合并策略, 为空时使用设置的合并策略
+	tag       string
+}
+
+// mergeTags 将多个 tag 合并为一个, 相同的 key 按后面 tag 的合并策略进行合并, 没有指定时 valid 为追加, 其他为替换
+// policies 为每个 key 首次出现时指定的合并策略, 用于和已有 tag 合并
+func mergeTags(tags []commentTag) (tag string, policies map[string]MergePolicy) {
+	merged := tagItems{}
+	policies = make(map[string]MergePolicy)
+	for _, t := range tags {
+		if t.directive != "" {
+			continue
+		}
+		inTags := newTagItems(t.tag)
+		for _, item := range inTags {
+			if _, ok := policies[item.key]; !ok && t.policy != "" {
+				policies[item.key] = t.policy
+			}
+		}
+
+		// 同一个字段的多个 @tag, valid 默认追加规则, 便于将较长的规则拆成多行; 其他的 key 默认后面的替换前面的
+		// 指定了合并策略时以指定的为准, 如: @tag-replace valid:"phone"
+		for _, item := range inTags {
+			policy := t.policy
+			if policy == "" {
+				policy = MergeReplace
+				if item.key == validTagKey {
+					policy = MergeAppend
+				}
+			}
+			merged = merged.merge(tagItems{item}, map[string]MergePolicy{item.key: policy})
+		}
+	}
+	return merged.format(), policies
+}
+
+// tagsFromComment 匹配注释中的注入 tag
+// 支持指定合并策略, 如: @tag-append valid:"phone"
+// 支持删除和重命名, 如: @tag-remove json, @tag-remove json:"omitempty", @tag-rename json=form
+// 标识可以通过 SetMarkers 设置, 简写的标识会展开为完整的 tag, 如: 设置 @valid=valid 后 @valid required => valid:"required"
+func tagsFromComment(comment string) (tags []commentTag) {
+	matches := rComment.FindAllStringSubmatchIndex(comment, -1)
+	// fmt.Printf("comment: %s, matches: %v\n", comment, matches)
+	tags = make([]commentTag, 0, len(matches))
+	for i, match := range matches {
+		// 内容截止到下一个标识或行尾, 所以同一行可以有多个标识
+		end := len(comment)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		if lineEnd := strings.IndexByte(comment[match[1]:end], '\n'); lineEnd != -1 {
+			end = match[1] + lineEnd
+		}
+		tag := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(comment[match[1]:end]), "*/"))
+
+		var directive string
+		if match[4] != -1 {
+			directive = comment[match[4]+1 : match[5]] // 去掉 -
+		}
+		if key := markerKey(comment[match[2]:match[3]]); key != "" {
+			tag = expandShorthand(key, directive, tag)
+		}
+		if tag == "" {
+			continue
+		}
+		switch directive {
+		case "":
+			tags = append(tags, commentTag{tag: tag})
+		case directiveRemove, directiveRename:
+			tags = append(tags, commentTag{directive: directive, tag: tag})
+		default:
+			policy, err := newMergePolicy(directive)
+			if err != nil {
+				continue
+			}
+			tags = append(tags, commentTag{policy: policy, tag: tag})
+		}
+	}
+	return
+}
+
+// directiveTags 获取 @tag-remove 和 @tag-rename 的内容
+func directiveTags(tags []commentTag) (removeTags []string, renameTags map[string]string) {
+	for _, t := range tags {
+		switch t.directive {
+		case directiveRemove:
+			removeTags = append(removeTags, strings.Fields(t.tag)...)
+		case directiveRename:
+			for _, item := range strings.FieldsFunc(t.tag, func(r rune) bool { return r == ' ' || r == ',' }) {
+				index := strings.Index(item, "=")
+				if index <= 0 || index == len(item)-1 {
+					continue
+				}
+				if renameTags == nil {
+					renameTags = make(map[string]string)
+				}
+				renameTags[item[:index]] = item[index+1:]
+			}
+		}
 	}
 	return
 }
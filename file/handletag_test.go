@@ -0,0 +1,190 @@
+package file
+
+import (
+	"reflect"
+	"testing"
+)
+
+func equal(dest, src interface{}) bool {
+	return reflect.DeepEqual(dest, src)
+}
+
+func TestIsInjected(t *testing.T) {
+	area := TextArea{CurrentTag: `json:"name"`, InjectTag: `valid:"required"`}
+	if area.IsInjected() {
+		t.Error("it should not injected")
+	}
+
+	area.CurrentTag = `json:"name" valid:"required"`
+	if !area.IsInjected() {
+		t.Error("it should injected")
+	}
+}
+
+func TestTagsFromComment(t *testing.T) {
+	tags := tagsFromComment("/*\n @tag valid:\"required\"\n @tag-union json:\"name\"\n*/")
+	sure := []commentTag{{tag: `valid:"required"`}, {policy: MergeUnion, tag: `json:"name"`}}
+	if !equal(tags, sure) {
+		t.Errorf("tags: %v", tags)
+	}
+
+	// 默认只有 @tag, 注释中的 @valid 不会处理
+	if tags = tagsFromComment(`// Email must be @valid according to RFC`); len(tags) != 0 {
+		t.Errorf("tags: %v", tags)
+	}
+
+	tag, policies := mergeTags([]commentTag{{tag: `valid:"required" json:"n"`}, {tag: `json:"name" valid:"phone"`}})
+	if tag != `valid:"required,phone" json:"name"` || len(policies) != 0 {
+		t.Error(tag, policies)
+	}
+
+	// 指定 replace 时替换
+	tag, _ = mergeTags([]commentTag{{tag: `valid:"required"`}, {policy: MergeReplace, tag: `valid:"phone"`}})
+	if tag != `valid:"phone"` {
+		t.Error(tag)
+	}
+
+	tag, _ = mergeTags([]commentTag{{tag: `valid:"required"`}, {policy: MergeAppend, tag: `valid:"phone"`}})
+	if tag != `valid:"required,phone"` {
+		t.Error(tag)
+	}
+}
+
+func TestInjectSplitLines(t *testing.T) {
+	// 较长的规则拆成多行时, 同一个 key 的规则会合并
+	src := []byte("package test\n\ntype Man struct {\n" +
+		"\t// @tag valid:\"required\"\n" +
+		"\t// @tag valid:\"to=1~64\" json:\"name\"\n" +
+		"\t// @tag valid:\"required\"\n" +
+		"\tName string\n" +
+		"}\n")
+	areas, err := ParseSrc("test.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(areas) != 1 || areas[0].FinalTag() != `valid:"required,to=1~64" json:"name"` {
+		t.Errorf("areas: %+v", areas)
+	}
+}
+
+func TestSetMarkers(t *testing.T) {
+	defer func() {
+		if err := SetMarkers(InjectTagFlag); err != nil {
+			t.Fatal(err)
+		}
+		if rules := structRulesFromComment("// @valid either(A,B)"); len(rules) != 1 {
+			t.Errorf("rules: %v", rules)
+		}
+	}()
+
+	// 简写的标识
+	if err := SetMarkers(InjectTagFlag, StructRuleFlag+"="+validTagKey); err != nil {
+		t.Fatal(err)
+	}
+	tags := tagsFromComment(`// @valid required,phone @valid-union to=1~3 @valid-remove @tag json:"name"`)
+	sure := []commentTag{{tag: `valid:"required,phone"`}, {policy: MergeUnion, tag: `valid:"to=1~3"`}, {directive: directiveRemove, tag: "valid"}, {tag: `json:"name"`}}
+	if !equal(tags, sure) {
+		t.Errorf("tags: %v", tags)
+	}
+
+	if err := SetMarkers("@inject", "@v=valid", "@vv=valid"); err != nil {
+		t.Fatal(err)
+	}
+	tags = tagsFromComment(`// @tag json:"name" @inject json:"nick" @vv phone @v required`)
+	sure = []commentTag{{tag: `json:"nick"`}, {tag: `valid:"phone"`}, {tag: `valid:"required"`}}
+	if !equal(tags, sure) {
+		t.Errorf("tags: %v", tags)
+	}
+
+	// 结构体级别的规则使用 key 为 valid 的简写标识
+	if rules := structRulesFromComment("// @valid either(A,B)"); len(rules) != 0 {
+		t.Errorf("rules: %v", rules)
+	}
+	if rules := structRulesFromComment("/*\n @vv either(A,B)\n @v botheq(C,D)\n*/"); len(rules) != 2 || rules[0] != "either(A,B)" || rules[1] != "botheq(C,D)" {
+		t.Errorf("rules: %v", rules)
+	}
+
+	for _, specs := range [][]string{{}, {"@v="}, {"@v=va lid"}, {"@v", "@v=valid"}} {
+		if err := SetMarkers(specs...); err == nil {
+			t.Errorf("%v should be failed", specs)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	old := newTagItems(`json:"name" valid:"required,to=1~3"`)
+	in := newTagItems(`valid:"to=1~5,phone"`)
+	testData := []struct {
+		policy MergePolicy
+		sure   string
+	}{
+		{MergeReplace, `json:"name" valid:"to=1~5,phone"`},
+		{MergeAppend, `json:"name" valid:"required,to=1~3,to=1~5,phone"`},
+		{MergeUnion, `json:"name" valid:"required,to=1~5,phone"`},
+	}
+	for _, v := range testData {
+		got := old.merge(in, map[string]MergePolicy{"valid": v.policy}).format()
+		if got != v.sure {
+			t.Errorf("policy: %s, got: %s", v.policy, got)
+		}
+	}
+}
+
+func TestNewTagItems(t *testing.T) {
+	tag := `json:"" x-key.name:"a\"b" valid:"required,re='\\d+'"  bad`
+	items := newTagItems(tag)
+	sure := tagItems{
+		{key: "json", value: `""`},
+		{key: "x-key.name", value: `"a\"b"`},
+		{key: "valid", value: `"required,re='\\d+'"`},
+		{value: "bad"},
+	}
+	if !items.equal(sure) {
+		t.Errorf("items: %v", items)
+	}
+	if got := items.format(); got != `json:"" x-key.name:"a\"b" valid:"required,re='\\d+'" bad` {
+		t.Error(got)
+	}
+
+	// 没有变化时保持原样
+	src := []byte("package test\n\ntype A struct {\n\tName string `json:\"name\"   valid:\"required\"` // @tag valid:\"required\"\n}\n")
+	areas, err := ParseSrc("test.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Inject(src, areas); string(got) != string(src) {
+		t.Error(string(got))
+	}
+}
+
+func TestDirective(t *testing.T) {
+	src := []byte("package test\n\ntype A struct {\n" +
+		"\tAmount int64 `json:\"amount,omitempty\" form:\"amount\"` // @tag-remove json:\"omitempty\" form\n" +
+		"\tName string `json:\"name\" form:\"x\"` // @tag-rename json=form @tag valid:\"required\"\n" +
+		"\tKind isA_Kind `protobuf_oneof:\"kind\"` // @tag-remove protobuf_oneof\n" +
+		"}\n")
+	areas, err := ParseSrc("test.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sure := "package test\n\ntype A struct {\n" +
+		"\tAmount int64    `json:\"amount\"`                // @tag-remove json:\"omitempty\" form\n" +
+		"\tName   string   `form:\"name\" valid:\"required\"` // @tag-rename json=form @tag valid:\"required\"\n" +
+		"\tKind   isA_Kind // @tag-remove protobuf_oneof\n" +
+		"}\n"
+	if got := string(Inject(src, areas)); got != sure {
+		t.Error(got)
+	}
+}
+
+func TestFinalTag(t *testing.T) {
+	area := TextArea{
+		CurrentTag: `json:"name,omitempty" valid:"required"`,
+		InjectTag:  `valid:"phone"`,
+		Policies:   map[string]MergePolicy{"valid": MergeAppend},
+		RemoveTags: []string{`json:"omitempty"`},
+	}
+	if got := area.FinalTag(); got != `json:"name" valid:"required,phone"` {
+		t.Error(got)
+	}
+}
@@ -0,0 +1,131 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gitee.com/xuesongtao/protoc-go-valid/valid"
+)
+
+const (
+	macroFlag     = "$" // 引用宏的标识, 如: valid:"$orderNo"
+	maxMacroDepth = 10  // 宏嵌套引用的最大层数
+)
+
+var (
+	macros = make(map[string]string) // 规则宏, key 为宏名, value 为 valid 的规则
+	rMacro = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+)
+
+// SetMacro 设置规则宏, 注入时 valid 中的 $name 会展开为 rules, 重复设置时后面的替换前面的
+// 如: SetMacro("orderNo", "required,to=1~64") 后 @tag valid:"$orderNo,phone" => valid:"required,to=1~64,phone"
+// rules 中也可以引用其他的宏, 如: SetMacro("payNo", "$orderNo,re='^P'")
+func SetMacro(name, rules string) error {
+	if !rMacro.MatchString(name) {
+		return errors.New("macro \"" + name + "\" name is invalid, it should be letters, digits or _")
+	}
+	if strings.TrimSpace(rules) == "" {
+		return errors.New("macro \"" + name + "\" rules is empty")
+	}
+	macros[name] = strings.TrimSpace(rules)
+	return nil
+}
+
+// LoadMacroFile 从文件中加载规则宏, 每行为: 宏名 = 规则, 空行和 # 开头的行会跳过
+// 如: orderNo = required,to=1~64,re='^[A-Za-z0-9_]+$'
+func LoadMacroFile(filename string) error {
+	data, err := ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	defined := make(map[string]int) // 宏名对应的行号, 用于判断同一个文件中是否重复定义
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		index := strings.Index(text, "=")
+		if index == -1 {
+			return fmt.Errorf("%s:%d: macro should be: name = rules", filename, line)
+		}
+		name := strings.TrimSpace(text[:index])
+		if definedLine, ok := defined[name]; ok {
+			return fmt.Errorf("%s:%d: macro %q is already defined at line %d", filename, line, name, definedLine)
+		}
+		if err := SetMacro(name, text[index+1:]); err != nil {
+			return fmt.Errorf("%s:%d: %v", filename, line, err)
+		}
+		defined[name] = line
+	}
+	return scanner.Err()
+}
+
+// expandMacros 展开 tag 中 valid 引用的宏, 只有单独作为一个规则的 $name 才会展开, 如: re='^a$b' 中的 $b 不会处理
+// 没有引用宏时返回原 tag, 引用了不存在的宏时报错
+func expandMacros(tag string) (string, error) {
+	if !strings.Contains(tag, macroFlag) {
+		return tag, nil
+	}
+
+	items := newTagItems(tag)
+	var isChanged bool
+	for index, item := range items {
+		if item.key != validTagKey || !strings.Contains(item.value, macroFlag) {
+			continue
+		}
+		value, err := strconv.Unquote(item.value)
+		if err != nil {
+			continue
+		}
+		expanded, err := expandRules(value, 0)
+		if err != nil {
+			return "", err
+		}
+		if expanded != value {
+			items[index].value = strconv.Quote(expanded)
+			isChanged = true
+		}
+	}
+	if !isChanged {
+		return tag, nil
+	}
+	return items.format(), nil
+}
+
+// expandRules 展开规则中引用的宏, depth 为嵌套的层数, 用于避免循环引用
+func expandRules(rules string, depth int) (string, error) {
+	if depth > maxMacroDepth {
+		return "", fmt.Errorf("macro is nested more than %d levels, it may be circular", maxMacroDepth)
+	}
+
+	names := valid.ValidNamesSplit(rules)
+	var isChanged bool
+	for index, name := range names {
+		name = strings.TrimSpace(name)
+		if !strings.HasPrefix(name, macroFlag) || !rMacro.MatchString(name[len(macroFlag):]) {
+			continue
+		}
+		macro, ok := macros[name[len(macroFlag):]]
+		if !ok {
+			return "", errors.New("macro \"" + name + "\" is not exist")
+		}
+		expanded, err := expandRules(macro, depth+1)
+		if err != nil {
+			return "", err
+		}
+		names[index] = expanded
+		isChanged = true
+	}
+	if !isChanged {
+		return rules, nil
+	}
+	return strings.Join(names, ","), nil
+}
@@ -0,0 +1,74 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandMacros(t *testing.T) {
+	defer func() { macros = make(map[string]string) }()
+
+	dir, err := ioutil.TempDir("", "macro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	macroFile := filepath.Join(dir, "valid.macro")
+	content := "# 订单号\n" +
+		"orderNo = required,to=1~64,re='^[A-Za-z0-9_]+$'\n\n" +
+		"payNo = $orderNo,re='^P'\n"
+	if err = ioutil.WriteFile(macroFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = LoadMacroFile(macroFile); err != nil {
+		t.Fatal(err)
+	}
+
+	testData := []struct {
+		tag  string
+		sure string
+	}{
+		{`valid:"$orderNo"`, `valid:"required,to=1~64,re='^[A-Za-z0-9_]+$'"`},
+		{`json:"$orderNo" valid:"$payNo,phone"`, `json:"$orderNo" valid:"required,to=1~64,re='^[A-Za-z0-9_]+$',re='^P',phone"`},
+		{`valid:"re='^a$orderNo'"`, `valid:"re='^a$orderNo'"`}, // 不是单独的规则不会展开
+	}
+	for _, v := range testData {
+		got, err := expandMacros(v.tag)
+		if err != nil || got != v.sure {
+			t.Errorf("tag: %s, got: %s, err: %v", v.tag, got, err)
+		}
+	}
+
+	if _, err = expandMacros(`valid:"$amount"`); err == nil || !strings.Contains(err.Error(), "not exist") {
+		t.Error(err)
+	}
+	if err = SetMacro("loop", "$loop"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = expandMacros(`valid:"$loop"`); err == nil {
+		t.Error("circular macro should be failed")
+	}
+
+	// 注入时展开
+	src := []byte("package test\n\ntype Order struct {\n\tNo string // @tag valid:\"$orderNo\"\n}\n")
+	areas, err := ParseSrc("test.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(areas) != 1 || areas[0].InjectTag != `valid:"required,to=1~64,re='^[A-Za-z0-9_]+$'"` {
+		t.Errorf("areas: %+v", areas)
+	}
+	if _, err = ParseSrc("test.go", []byte("package test\n\ntype Order struct {\n\tNo string // @tag valid:\"$amount\"\n}\n")); err == nil {
+		t.Error("it should be failed")
+	}
+
+	if err = ioutil.WriteFile(macroFile, []byte("a = required\na = phone\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = LoadMacroFile(macroFile); err == nil || !strings.Contains(err.Error(), "already defined") {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,123 @@
+package file
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// marker 注释中注入 tag 的标识
+type marker struct {
+	name string // 标识, 如: @tag
+	key  string // 简写对应的 tag key, 为空时内容为完整的 tag, 如: key 为 valid 时 @valid required => valid:"required"
+}
+
+var (
+	markers     = []marker{{name: InjectTagFlag}}               // 默认的标识
+	rComment    = newMarkerRegexp(markers)                      // 匹配注入 tag 的标识, 如: @tag valid:"required", @tag-union valid:"phone"
+	rStructRule = newStructRuleRegexp([]string{StructRuleFlag}) // 匹配结构体级别规则的标识, 如: @valid either(OrderNo,TradeNo)
+)
+
+// markerPattern 将多个标识组合为正则的分支, 长的优先匹配, 避免 @v 匹配到 @valid
+func markerPattern(names []string) string {
+	patterns := make([]string, 0, len(names))
+	for _, name := range names {
+		patterns = append(patterns, regexp.QuoteMeta(name))
+	}
+	sort.SliceStable(patterns, func(i, j int) bool { return len(patterns[i]) > len(patterns[j]) })
+	return strings.Join(patterns, "|")
+}
+
+// newMarkerRegexp 根据标识生成匹配的正则, 子匹配依次为: 标识, 指令(如: -union)
+func newMarkerRegexp(markers []marker) *regexp.Regexp {
+	names := make([]string, 0, len(markers))
+	for _, m := range markers {
+		names = append(names, m.name)
+	}
+	return regexp.MustCompile(`(?m)(` + markerPattern(names) + `)(-\w+)?( |$)`)
+}
+
+// newStructRuleRegexp 根据结构体级别规则的标识生成匹配的正则, 子匹配为规则的内容
+func newStructRuleRegexp(names []string) *regexp.Regexp {
+	return regexp.MustCompile(`(?:` + markerPattern(names) + `)\s+(.*)`)
+}
+
+// SetMarkers 设置注释中注入 tag 的标识, 会替换默认的 @tag, 每个可以为:
+// 1. 标识, 内容为完整的 tag, 如: @inject => @inject valid:"required"
+// 2. 标识=key, 内容为 key 的值, 如: @valid=valid => @valid required 等价于 @tag valid:"required"
+// 指令同样适用, 如: @valid-union phone, @valid-remove required
+// key 为 valid 的简写标识同时作为结构体注释上的规则标识, 如: @v=valid => // @v either(A,B); 没有时为默认的 @valid
+func SetMarkers(markerSpecs ...string) error {
+	newMarkers := make([]marker, 0, len(markerSpecs))
+	exist := make(map[string]bool, len(markerSpecs))
+	for _, spec := range markerSpecs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		var m marker
+		m.name = spec
+		if index := strings.Index(spec, "="); index != -1 {
+			m.name, m.key = strings.TrimSpace(spec[:index]), strings.TrimSpace(spec[index+1:])
+			if m.key == "" || strings.ContainsAny(m.key, " \t:\"`") {
+				return errors.New("marker \"" + spec + "\" key is invalid")
+			}
+		}
+		if m.name == "" || strings.ContainsAny(m.name, " \t\"`") {
+			return errors.New("marker \"" + spec + "\" name is invalid")
+		}
+		if exist[m.name] {
+			return errors.New("marker \"" + m.name + "\" is repeated")
+		}
+		exist[m.name] = true
+		newMarkers = append(newMarkers, m)
+	}
+	if len(newMarkers) == 0 {
+		return errors.New("markers is empty")
+	}
+
+	structNames := make([]string, 0, 1)
+	for _, m := range newMarkers {
+		if m.key == validTagKey {
+			structNames = append(structNames, m.name)
+		}
+	}
+	if len(structNames) == 0 {
+		structNames = append(structNames, StructRuleFlag)
+	}
+
+	markers = newMarkers
+	rComment = newMarkerRegexp(markers)
+	rStructRule = newStructRuleRegexp(structNames)
+	return nil
+}
+
+// markerKey 获取标识简写对应的 tag key
+func markerKey(name string) string {
+	for _, m := range markers {
+		if m.name == name {
+			return m.key
+		}
+	}
+	return ""
+}
+
+// expandShorthand 将简写的内容展开为完整的 tag, 如: valid, required => valid:"required"
+// remove 没有内容时为删除整个 key, rename 的内容保持不变
+func expandShorthand(key, directive, content string) string {
+	switch directive {
+	case directiveRename:
+		return content
+	case directiveRemove:
+		if content == "" {
+			return key
+		}
+	}
+	if content == "" {
+		return ""
+	}
+	return key + ":" + strconv.Quote(content)
+}
@@ -0,0 +1,152 @@
+package file
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"gitee.com/xuesongtao/protoc-go-valid/valid"
+)
+
+// MergePolicy 已有 tag 和待注入 tag 的 key 重复时的合并策略
+type MergePolicy string
+
+const (
+	MergeReplace MergePolicy = "replace" // 替换, 如: required + phone => phone
+	MergeAppend  MergePolicy = "append"  // 追加规则, 完全相同的规则不会重复追加, 如: required + phone => required,phone
+	MergeUnion   MergePolicy = "union"   // 合并规则并按规则名去重, 以待注入的为准, 如: required,to=1~3 + to=1~5 => required,to=1~5
+
+	allKeyPolicy = "*" // 所有 key 的默认合并策略
+)
+
+var (
+	// 合并策略, key 为 tag 的 key
+	mergePolicies = map[string]MergePolicy{allKeyPolicy: MergeReplace}
+)
+
+// newMergePolicy 校验合并策略
+func newMergePolicy(policy string) (MergePolicy, error) {
+	switch p := MergePolicy(policy); p {
+	case MergeReplace, MergeAppend, MergeUnion:
+		return p, nil
+	}
+	return "", errors.New("merge policy \"" + policy + "\" is not exist, it should be replace/append/union")
+}
+
+// SetMergePolicy 设置合并策略, 多个通过逗号隔开, 可以多次调用
+// 如: "union" 为所有的 key 设置; "valid=union,json=replace" 为指定的 key 设置
+func SetMergePolicy(spec string) error {
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		key, policy := allKeyPolicy, item
+		if index := strings.Index(item, "="); index != -1 {
+			key, policy = item[:index], item[index+1:]
+		}
+		p, err := newMergePolicy(policy)
+		if err != nil {
+			return err
+		}
+		mergePolicies[key] = p
+	}
+	return nil
+}
+
+// getMergePolicy 获取 key 的合并策略, 优先级: 注释中指定的 > 设置的 key > 设置的所有 key
+func getMergePolicy(key string, policies map[string]MergePolicy) MergePolicy {
+	if p, ok := policies[key]; ok && p != "" {
+		return p
+	}
+	if p, ok := mergePolicies[key]; ok {
+		return p
+	}
+	return mergePolicies[allKeyPolicy]
+}
+
+// merge 将待注入的 tag 按合并策略合并到现有的 tag 中, 新的 key 会追加到最后
+func (t tagItems) merge(inTags tagItems, policies map[string]MergePolicy) tagItems {
+	merged := make(tagItems, len(t), len(t)+len(inTags))
+	copy(merged, t)
+	for _, inTag := range inTags {
+		if inTag.key == "" { // 注释中无法解析的内容跳过
+			continue
+		}
+		dup := -1
+		for i := range merged {
+			if merged[i].key == inTag.key {
+				dup = i
+				break
+			}
+		}
+		if dup == -1 {
+			merged = append(merged, inTag)
+			continue
+		}
+		merged[dup] = mergeItem(merged[dup], inTag, getMergePolicy(inTag.key, policies))
+	}
+	return merged
+}
+
+// mergeItem 按合并策略合并 key 相同的两项
+func mergeItem(old, in tagItem, policy MergePolicy) tagItem {
+	if policy == MergeReplace {
+		return in
+	}
+
+	oldVal, err1 := strconv.Unquote(old.value)
+	inVal, err2 := strconv.Unquote(in.value)
+	if err1 != nil || err2 != nil { // 值不规范就直接替换
+		return in
+	}
+
+	oldRules, inRules := valid.ValidNamesSplit(oldVal), valid.ValidNamesSplit(inVal)
+	var rules []string
+	switch policy {
+	case MergeAppend:
+		rules = appendRules(oldRules, inRules)
+	case MergeUnion:
+		rules = unionRules(oldRules, inRules)
+	}
+	return tagItem{key: old.key, value: strconv.Quote(strings.Join(rules, ","))}
+}
+
+// appendRules 追加规则, 已存在完全相同的规则时跳过, 保证多次注入的结果一致
+func appendRules(oldRules, inRules []string) []string {
+	rules := make([]string, 0, len(oldRules)+len(inRules))
+	rules = append(rules, oldRules...)
+	for _, inRule := range inRules {
+		var isExist bool
+		for _, rule := range oldRules {
+			if rule == inRule {
+				isExist = true
+				break
+			}
+		}
+		if !isExist {
+			rules = append(rules, inRule)
+		}
+	}
+	return rules
+}
+
+// unionRules 合并规则并按规则名去重, 规则名相同时以待注入的为准
+func unionRules(oldRules, inRules []string) []string {
+	rules := make([]string, 0, len(oldRules)+len(inRules))
+	name2Index := make(map[string]int, len(oldRules)+len(inRules))
+	for _, rule := range append(oldRules, inRules...) {
+		if rule == "" {
+			continue
+		}
+		name, _, _ := valid.ParseValidNameKV(rule)
+		if index, ok := name2Index[name]; ok {
+			rules[index] = rule
+			continue
+		}
+		name2Index[name] = len(rules)
+		rules = append(rules, rule)
+	}
+	return rules
+}
@@ -1,30 +1,38 @@
 package file
 
 import (
+	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
-	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
-)
 
-const (
-	InjectTagFlag = "@tag" // 注入 tag 的标识
+	"gitee.com/xuesongtao/protoc-go-valid/valid"
 )
 
-var (
-	rComment = regexp.MustCompile(`@tag (.*)`) // 匹配注入 tag
-	rInject  = regexp.MustCompile("`.+`$")
-	rTags    = regexp.MustCompile(`\w+:"[^"]+"`) // 匹配 tag
+const (
+	InjectTagFlag  = "@tag"   // 注入 tag 的默认标识, 可以通过 SetMarkers 修改
+	StructRuleFlag = "@valid" // 结构体级别规则的默认标识, 写在结构体的注释上, 如: @valid either(OrderNo,TradeNo)
 )
 
-// textArea
-type textArea struct {
-	Start      int    // 开始位置
-	End        int    // 截止位置
-	CurrentTag string // 已有 tag
-	InjectTag  string // 注入的 tag
+// TextArea 待注入的区域
+type TextArea struct {
+	Start      int                    // 开始位置, 字段没有 tag 时为字段类型的末尾
+	End        int                    // 截止位置
+	HasTag     bool                   // 字段是否已有 tag
+	Line       int                    // 所在行
+	StructName string                 // 结构体名
+	FieldName  string                 // 字段名, 一行声明多个字段时为第一个
+	FieldNames []string               // 字段声明的所有名字, 如: A, B string 为 [A B], tag 对所有的名字都生效
+	CurrentTag string                 // 已有 tag
+	InjectTag  string                 // 注入的 tag
+	Policies   map[string]MergePolicy // 注释中指定的合并策略, key 为 tag 的 key
+	RemoveTags []string               // 待删除的 tag, 如: json 为删除整个 key, json:"omitempty" 为删除 key 中的规则
+	RenameTags map[string]string      // 待重命名的 key, key 为旧的, value 为新的
+	IsNewField bool                   // 是否需要新增字段, 结构体级别的规则没有 _ 字段时会在结构体末尾新增, Start 等于 End 为结构体的 }
 }
 
 // HandlePath 处理最后一个的路径服务
@@ -39,62 +47,306 @@ func HandlePath(path string) string {
 	return path
 }
 
+// fieldName 获取字段名, 匿名字段为类型名
+func fieldName(field *ast.Field) string {
+	if len(field.Names) > 0 {
+		return field.Names[0].Name
+	}
+
+	expr := field.Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch ty := expr.(type) {
+	case *ast.Ident:
+		return ty.Name
+	case *ast.SelectorExpr:
+		return ty.Sel.Name
+	}
+	return ""
+}
+
+// fieldNames 获取字段声明的所有名字, 如: A, B string 为 [A B], 匿名字段为类型名
+func fieldNames(field *ast.Field) []string {
+	if len(field.Names) == 0 {
+		return []string{fieldName(field)}
+	}
+	names := make([]string, 0, len(field.Names))
+	for _, name := range field.Names {
+		names = append(names, name.Name)
+	}
+	return names
+}
+
+// commentsOfField 获取字段的注释, 包含字段上方的文档注释和行尾注释
+func commentsOfField(field *ast.Field) []string {
+	comments := make([]string, 0, 2)
+	for _, group := range []*ast.CommentGroup{field.Doc, field.Comment} {
+		if group == nil {
+			continue
+		}
+		for _, comment := range group.List {
+			comments = append(comments, comment.Text)
+		}
+	}
+	return comments
+}
+
+// FieldComments 结构体字段对应的注释, key 为: 结构体名.字段名, 结构体的注释 key 为: 结构体名._
+// 主要用于注释不在 go 源码中的场景, 如: 从 proto 源文件中获取注释
+type FieldComments map[string][]string
+
+// Get 获取字段的注释
+func (f FieldComments) Get(structName, fieldName string) []string {
+	if len(f) == 0 {
+		return nil
+	}
+	return f[structName+"."+fieldName]
+}
+
+// parseSrcFile 解析源码, src 为 nil 时会读取 filename 的内容
+func parseSrcFile(fSet *token.FileSet, filename string, src []byte, mode parser.Mode) (*ast.File, error) {
+	var srcData interface{} // 需要为 nil 的 interface, parser.ParseFile 才会读取文件
+	if src != nil {
+		srcData = src
+	}
+	return parser.ParseFile(fSet, filename, srcData, mode)
+}
+
+// topTypeSpecs 获取顶层声明的类型, 不包含函数内声明的类型
+func topTypeSpecs(f *ast.File) []*ast.TypeSpec {
+	typeSpecs := make([]*ast.TypeSpec, 0, 4)
+	for _, decl := range f.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpecs = append(typeSpecs, spec.(*ast.TypeSpec))
+		}
+	}
+	return typeSpecs
+}
+
 // ParseFile 解析文件
-func ParseFile(inputPath string) (areas []textArea, err error) {
+func ParseFile(inputPath string) (areas []TextArea, err error) {
+	return ParseSrc(inputPath, nil)
+}
+
+// ParseSrc 解析源码, src 为 nil 时会读取 filename 的内容
+// fieldComments 有值时, 字段的注释以 fieldComments 为准, 否则以源码中的注释为准
+func ParseSrc(filename string, src []byte, fieldComments ...FieldComments) (areas []TextArea, err error) {
 	fSet := token.NewFileSet()
-	f, err := parser.ParseFile(fSet, inputPath, nil, parser.ParseComments)
+	f, err := parseSrcFile(fSet, filename, src, parser.ParseComments)
 	if err != nil {
 		return
 	}
-	for _, decl := range f.Decls {
-		genDecl, ok := decl.(*ast.GenDecl)
-		if !ok {
-			continue
+
+	var cusComments FieldComments
+	if len(fieldComments) > 0 {
+		cusComments = fieldComments[0]
+	}
+	// 遍历所有的结构体, 包含: type ( A struct{}; B struct{} ), 函数内声明的结构体, 匿名结构体等
+	structNames := make(map[*ast.StructType]string)           // 结构体对应的名字, 匿名结构体为: 外层结构体名.字段名
+	structDocs := make(map[*ast.StructType]*ast.CommentGroup) // 结构体的文档注释
+	ast.Inspect(f, func(node ast.Node) bool {
+		if err != nil {
+			return false
 		}
 
-		var typeSpec *ast.TypeSpec // 类型
-		for _, spec := range genDecl.Specs {
-			if ts, tsOK := spec.(*ast.TypeSpec); tsOK {
-				typeSpec = ts
-				break
+		switch n := node.(type) {
+		case *ast.GenDecl:
+			// type A struct{} 的文档注释在 GenDecl 上
+			if n.Tok == token.TYPE && !n.Lparen.IsValid() && len(n.Specs) == 1 {
+				if structDecl, ok := n.Specs[0].(*ast.TypeSpec).Type.(*ast.StructType); ok {
+					structDocs[structDecl] = n.Doc
+				}
+			}
+		case *ast.TypeSpec:
+			if structDecl, ok := n.Type.(*ast.StructType); ok {
+				structNames[structDecl] = n.Name.Name
+				if n.Doc != nil {
+					structDocs[structDecl] = n.Doc
+				}
+			}
+		case *ast.StructType:
+			structName := structNames[n]
+			for _, field := range n.Fields.List {
+				nestedName := fieldName(field)
+				if structName != "" {
+					nestedName = structName + "." + nestedName
+				}
+				nestedStructNames(structNames, nestedName, field.Type)
 			}
-		}
 
-		// 空就跳过
-		if typeSpec == nil {
-			continue
+			var structComments []string
+			if cusComments != nil {
+				structComments = cusComments.Get(structName, valid.StructRuleField)
+			} else if doc := structDocs[n]; doc != nil {
+				for _, comment := range doc.List {
+					structComments = append(structComments, comment.Text)
+				}
+			}
+
+			var structAreas []TextArea
+			if structAreas, err = parseStruct(fSet, structName, n, structComments, cusComments); err != nil {
+				return false
+			}
+			areas = append(areas, structAreas...)
 		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 嵌套结构体的字段会在外层字段之后解析, 需要按位置排序, 保证从尾部注入时的顺序
+	sort.SliceStable(areas, func(i, j int) bool { return areas[i].Start < areas[j].Start })
+	return
+}
 
-		// 不是结构体就跳过
-		structDecl, ok := typeSpec.Type.(*ast.StructType)
+// nestedStructNames 给字段类型中的匿名结构体命名, 如: []struct{}, map[string]*struct{}
+func nestedStructNames(structNames map[*ast.StructType]string, name string, fieldType ast.Expr) {
+	ast.Inspect(fieldType, func(node ast.Node) bool {
+		structDecl, ok := node.(*ast.StructType)
 		if !ok {
-			continue
+			return true
+		}
+		structNames[structDecl] = name
+		return false // 更深层的由该结构体自己处理
+	})
+}
+
+// structRulesFromComment 获取注释中结构体级别的规则, 多个规则可以通过空格或逗号隔开
+// 如: @valid either(OrderNo,TradeNo) botheq(Pwd, RePwd) => ["either(OrderNo,TradeNo)", "botheq(Pwd,RePwd)"]
+func structRulesFromComment(comment string) (rules []string) {
+	for _, match := range rStructRule.FindAllStringSubmatch(comment, -1) {
+		content := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(match[1]), "*/"))
+		var (
+			depth int
+			rule  []byte
+		)
+		for i := 0; i < len(content); i++ {
+			c := content[i]
+			switch {
+			case c == '(':
+				depth++
+			case c == ')':
+				depth--
+			case c == ' ' || c == '\t':
+				continue
+			case c == ',' && depth == 0:
+				if len(rule) > 0 {
+					rules = append(rules, string(rule))
+				}
+				rule = rule[:0:0]
+				continue
+			}
+			rule = append(rule, c)
+			// 括号结束为一个规则, 后面可以直接跟空格
+			if c == ')' && depth == 0 {
+				rules = append(rules, string(rule))
+				rule = rule[:0:0]
+			}
 		}
+		if len(rule) > 0 {
+			rules = append(rules, string(rule))
+		}
+	}
+	return
+}
+
+// isEmptyStruct 判断字段类型是否为 struct{}
+func isEmptyStruct(expr ast.Expr) bool {
+	structDecl, ok := expr.(*ast.StructType)
+	return ok && len(structDecl.Fields.List) == 0
+}
 
-		for _, field := range structDecl.Fields.List {
-			var comments []*ast.Comment
-			// 字段的注释
-			if field.Comment != nil {
-				comments = append(comments, field.Comment.List...)
+// parseStruct 解析结构体中需要注入的字段
+// structComments 中有结构体级别的规则时, 会注入到字段 _ struct{} 的 tag 中, 没有该字段就新增
+func parseStruct(fSet *token.FileSet, structName string, structDecl *ast.StructType, structComments []string, cusComments FieldComments) (areas []TextArea, err error) {
+	var structRules []string
+	for _, comment := range structComments {
+		structRules = append(structRules, structRulesFromComment(comment)...)
+	}
+	var ruleTag *commentTag
+	if len(structRules) > 0 {
+		ruleTag = &commentTag{tag: "valid:" + strconv.Quote(strings.Join(structRules, ","))}
+	}
+
+	for _, field := range structDecl.Fields.List {
+		name := fieldName(field)
+		var comments []string
+		if cusComments != nil {
+			// _ 的 key 为结构体的注释, 已经作为结构体级别的规则处理
+			if name != valid.StructRuleField {
+				comments = cusComments.Get(structName, name)
 			}
+		} else {
+			comments = commentsOfField(field)
+		}
 
-			// 组装数据
-			for _, comment := range comments {
-				tag := tagFromComment(comment.Text)
-				if tag == "" {
-					continue
-				}
+		// 多个 @tag 合并为一个
+		tags := make([]commentTag, 0, len(comments))
+		for _, comment := range comments {
+			tags = append(tags, tagsFromComment(comment)...)
+		}
+		if ruleTag != nil && name == valid.StructRuleField && isEmptyStruct(field.Type) {
+			tags = append(tags, *ruleTag)
+			ruleTag = nil
+		}
+		if len(tags) == 0 {
+			continue
+		}
+		// 在合并之前展开宏, 合并策略才能按展开后的规则处理
+		for index := range tags {
+			if tags[index].directive == directiveRename {
+				continue
+			}
+			if tags[index].tag, err = expandMacros(tags[index].tag); err != nil {
+				return nil, fmt.Errorf("%s: field %q %v", fSet.Position(field.Pos()), name, err)
+			}
+		}
+		injectTag, policies := mergeTags(tags)
+		removeTags, renameTags := directiveTags(tags)
 
-				currentTag := field.Tag.Value
-				area := textArea{
-					Start:      int(field.Pos()),
-					End:        int(field.End()),
-					CurrentTag: currentTag[1 : len(currentTag)-1], // 去掉 ``
-					InjectTag:  tag,
-				}
-				areas = append(areas, area)
+		// 组装数据
+		area := TextArea{
+			Line:       fSet.Position(field.Pos()).Line,
+			StructName: structName,
+			FieldName:  name,
+			FieldNames: fieldNames(field),
+			InjectTag:  injectTag,
+			Policies:   policies,
+			RemoveTags: removeTags,
+			RenameTags: renameTags,
+		}
+		if field.Tag != nil {
+			area.HasTag = true
+			area.Start = int(field.Tag.Pos())
+			area.End = int(field.Tag.End())
+			if area.CurrentTag, err = strconv.Unquote(field.Tag.Value); err != nil { // 去掉 ``
+				return nil, fmt.Errorf("%s: unquote tag is failed, err: %v", fSet.Position(field.Tag.Pos()), err)
 			}
+		} else { // 没有 tag 的时候在类型后面新增
+			area.Start = int(field.Type.End())
+			area.End = area.Start
 		}
+		areas = append(areas, area)
+	}
+
+	// 没有 _ 字段时在结构体末尾新增
+	if ruleTag != nil {
+		areas = append(areas, TextArea{
+			Start:      int(structDecl.Fields.Closing),
+			End:        int(structDecl.Fields.Closing),
+			Line:       fSet.Position(structDecl.Fields.Closing).Line,
+			StructName: structName,
+			FieldName:  valid.StructRuleField,
+			FieldNames: []string{valid.StructRuleField},
+			InjectTag:  ruleTag.tag,
+			IsNewField: true,
+		})
 	}
 	return
 }
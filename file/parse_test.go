@@ -0,0 +1,119 @@
+package file
+
+import "testing"
+
+func TestParseSrc(t *testing.T) {
+	src := []byte("package test\n\n" +
+		"type (\n" +
+		"\tA struct {\n" +
+		"\t\tName string // @tag valid:\"required\"\n" +
+		"\t}\n" +
+		"\tB struct {\n" +
+		"\t\tAge int `json:\"age\"` // @tag valid:\"ge=1\"\n" +
+		"\t}\n" +
+		")\n")
+	areas, err := ParseSrc("test.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(areas) != 2 {
+		t.Fatalf("areas is not ok: %+v", areas)
+	}
+
+	sure := "package test\n\n" +
+		"type (\n" +
+		"\tA struct {\n" +
+		"\t\tName string `valid:\"required\"` // @tag valid:\"required\"\n" +
+		"\t}\n" +
+		"\tB struct {\n" +
+		"\t\tAge int `json:\"age\" valid:\"ge=1\"` // @tag valid:\"ge=1\"\n" +
+		"\t}\n" +
+		")\n"
+	if got := string(Inject(src, areas)); got != sure {
+		t.Error(got)
+	}
+}
+
+func TestParseSrcNested(t *testing.T) {
+	src := []byte("package test\n\n" +
+		"type Outer struct {\n" +
+		"\tInner struct {\n" +
+		"\t\tName string // @tag valid:\"required\"\n" +
+		"\t} `json:\"inner\"` // @tag valid:\"required\"\n" +
+		"}\n\n" +
+		"func f() {\n" +
+		"\ttype Local struct {\n" +
+		"\t\tAge int // @tag valid:\"ge=1\"\n" +
+		"\t}\n" +
+		"}\n")
+	areas, err := ParseSrc("test.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sureNames := []string{"Outer.Inner.Name", "Outer.Inner", "Local.Age"}
+	if len(areas) != len(sureNames) {
+		t.Fatalf("areas is not ok: %+v", areas)
+	}
+	for i, area := range areas {
+		if name := area.StructName + "." + area.FieldName; name != sureNames[i] {
+			t.Errorf("name: %s, sure: %s", name, sureNames[i])
+		}
+	}
+
+	sure := "package test\n\n" +
+		"type Outer struct {\n" +
+		"\tInner struct {\n" +
+		"\t\tName string `valid:\"required\"` // @tag valid:\"required\"\n" +
+		"\t} `json:\"inner\" valid:\"required\"` // @tag valid:\"required\"\n" +
+		"}\n\n" +
+		"func f() {\n" +
+		"\ttype Local struct {\n" +
+		"\t\tAge int `valid:\"ge=1\"` // @tag valid:\"ge=1\"\n" +
+		"\t}\n" +
+		"}\n"
+	if got := string(Inject(src, areas)); got != sure {
+		t.Error(got)
+	}
+}
+
+func TestParseSrcStructRule(t *testing.T) {
+	src := []byte("package test\n\n" +
+		"// Order 订单\n" +
+		"// @valid either(OrderNo,TradeNo) botheq(Pwd, RePwd)\n" +
+		"type Order struct {\n" +
+		"\tOrderNo string\n" +
+		"\tTradeNo string\n" +
+		"\tPwd     string\n" +
+		"\tRePwd   string\n" +
+		"}\n")
+	areas, err := ParseSrc("test.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sure := "package test\n\n" +
+		"// Order 订单\n" +
+		"// @valid either(OrderNo,TradeNo) botheq(Pwd, RePwd)\n" +
+		"type Order struct {\n" +
+		"\tOrderNo string\n" +
+		"\tTradeNo string\n" +
+		"\tPwd     string\n" +
+		"\tRePwd   string\n" +
+		"\t_       struct{} `valid:\"either(OrderNo,TradeNo),botheq(Pwd,RePwd)\"`\n" +
+		"}\n"
+	injected := Inject(src, areas)
+	if string(injected) != sure {
+		t.Fatal(string(injected))
+	}
+
+	// 再次注入时使用已有的 _ 字段
+	if areas, err = ParseSrc("test.go", injected); err != nil {
+		t.Fatal(err)
+	}
+	if len(areas) != 1 || areas[0].IsNewField || !areas[0].IsInjected() {
+		t.Errorf("areas is not ok: %+v", areas)
+	}
+	if err := areas[0].CheckValid(); err != nil {
+		t.Error(err)
+	}
+}
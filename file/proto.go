@@ -0,0 +1,465 @@
+package file
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gitee.com/xuesongtao/protoc-go-valid/valid"
+)
+
+var rProtoSource = regexp.MustCompile(`(?m)^// source: (\S+\.proto)\s*$`) // 匹配 protoc-gen-go 生成文件头部的 proto 源文件, 如: // source: test/test.proto
+
+// protoReservedNames protoc-gen-go 生成的方法名, 字段名和它们冲突时会在末尾加 _
+var protoReservedNames = map[string]bool{
+	"Reset":               true,
+	"String":              true,
+	"ProtoMessage":        true,
+	"Marshal":             true,
+	"Unmarshal":           true,
+	"ExtensionRangeArray": true,
+	"ExtensionMap":        true,
+	"Descriptor":          true,
+}
+
+// protoComment proto 中的注释
+type protoComment struct {
+	text      string
+	line      int  // 开始行
+	endLine   int  // 结束行, 块注释可能有多行
+	afterCode bool // 同一行的前面是否有代码, 有的话为上一个元素的行尾注释
+}
+
+// protoToken proto 中的词
+type protoToken struct {
+	text     string
+	line     int
+	isString bool
+	comments []protoComment // 上一个词和该词之间的注释
+}
+
+// protoField proto 中的字段
+type protoField struct {
+	name     string
+	oneof    string // 所属的 oneof, 为空表示不在 oneof 中
+	comments []string
+}
+
+// protoParser 解析 proto 文件, 只关心 message 和字段的注释
+type protoParser struct {
+	filename string
+	toks     []protoToken
+	pos      int
+	comments FieldComments
+}
+
+// ProtoSource 获取 protoc-gen-go 生成的 go 源码对应的 proto 文件, 如: test/test.proto, 没有时返回空
+func ProtoSource(src []byte) string {
+	match := rProtoSource.FindSubmatch(src)
+	if match == nil {
+		return ""
+	}
+	return string(match[1])
+}
+
+// ParseProtoFile 解析 proto 文件中 message 和字段的注释
+func ParseProtoFile(filename string) (FieldComments, error) {
+	src, err := ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseProtoSrc(filename, src)
+}
+
+// ParseProtoSrc 解析 proto 源码中 message 和字段的注释, 返回的 key 和 protoc-gen-go 生成的 go 结构体一致
+// 1. message 的前置注释 key 为: 结构体名._, 用于结构体级别的规则
+// 2. 字段的前置注释和行尾注释 key 为: 结构体名.字段名, 嵌套 message 的结构体名为: Outer_Inner
+// 3. oneof 的字段会额外设置包装结构体的 key, 如: Msg_Field.Field
+func ParseProtoSrc(filename string, src []byte) (FieldComments, error) {
+	toks, err := protoTokens(filename, src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &protoParser{filename: filename, toks: toks, comments: make(FieldComments)}
+	for !p.eof() {
+		tok := p.next()
+		switch tok.text {
+		case "message":
+			err = p.parseMessage(tok, "")
+		case "enum", "service", "extend":
+			err = p.skipStatement()
+		case ";":
+		default: // syntax, package, import, option 等
+			err = p.skipStatement()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p.comments, nil
+}
+
+// parseMessage 解析 message, tok 为 message 关键字, parent 为外层 message 的全名
+func (p *protoParser) parseMessage(tok protoToken, parent string) error {
+	nameTok := p.next()
+	fullName := nameTok.text
+	if parent != "" {
+		fullName = parent + "." + fullName
+	}
+	goName := goCamelCase(fullName)
+	if comments := leadingComments(tok); len(comments) > 0 {
+		p.comments[goName+"."+valid.StructRuleField] = comments
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+
+	var (
+		fields      []protoField
+		nestedNames = make(map[string]bool) // 嵌套的 message 和 enum 的 go 名, 用于处理 oneof 包装结构体的冲突
+	)
+	for {
+		if p.eof() {
+			return p.errorf(nameTok, "message %q is not closed", fullName)
+		}
+		tok := p.next()
+		var err error
+		switch tok.text {
+		case "}":
+			p.setFieldComments(goName, fields, nestedNames)
+			return nil
+		case ";":
+		case "message":
+			nestedNames[goCamelCase(fullName+"."+p.peek().text)] = true
+			err = p.parseMessage(tok, fullName)
+		case "enum":
+			nestedNames[goCamelCase(fullName+"."+p.peek().text)] = true
+			err = p.skipStatement()
+		case "extend", "option", "reserved", "extensions":
+			err = p.skipStatement()
+		case "oneof":
+			oneof := p.next().text
+			if err = p.expect("{"); err != nil {
+				return err
+			}
+			for !p.eof() && p.peek().text != "}" {
+				fieldTok := p.next()
+				switch fieldTok.text {
+				case ";":
+				case "option":
+					err = p.skipStatement()
+				default:
+					var field protoField
+					if field, err = p.parseField(fieldTok); err == nil {
+						field.oneof = oneof
+						fields = append(fields, field)
+					}
+				}
+				if err != nil {
+					return err
+				}
+			}
+			err = p.expect("}")
+		default:
+			var field protoField
+			if field, err = p.parseField(tok); err == nil {
+				fields = append(fields, field)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parseField 解析字段, 如: repeated string name = 1 [json_name = "n"]; map<string, int32> m = 2;
+func (p *protoParser) parseField(tok protoToken) (field protoField, err error) {
+	cur := tok
+	if cur.text == "optional" || cur.text == "repeated" || cur.text == "required" {
+		cur = p.next()
+	}
+	// 类型
+	if cur.text == "map" && p.peek().text == "<" {
+		for !p.eof() && cur.text != ">" {
+			cur = p.next()
+		}
+	}
+	if cur.text == "group" {
+		return field, p.errorf(cur, "group is not supported")
+	}
+
+	nameTok := p.next()
+	field.name = nameTok.text
+	if err = p.expect("="); err != nil {
+		return
+	}
+	p.next() // 字段编号
+	if p.peek().text == "[" {
+		for !p.eof() && p.peek().text != "]" {
+			p.next()
+		}
+		if err = p.expect("]"); err != nil {
+			return
+		}
+	}
+	end := p.next()
+	if end.text != ";" {
+		return field, p.errorf(end, "expected \";\", got %q", end.text)
+	}
+
+	field.comments = append(leadingComments(tok), p.trailingComments(end)...)
+	return
+}
+
+// setFieldComments 按 protoc-gen-go 的规则获取字段的 go 名并设置注释
+func (p *protoParser) setFieldComments(goName string, fields []protoField, nestedNames map[string]bool) {
+	usedNames := make(map[string]bool, len(protoReservedNames))
+	for name := range protoReservedNames {
+		usedNames[name] = true
+	}
+	makeNameUnique := func(name string, hasGetter bool) string {
+		for usedNames[name] || (hasGetter && usedNames["Get"+name]) {
+			name += "_"
+		}
+		usedNames[name] = true
+		usedNames["Get"+name] = hasGetter
+		return name
+	}
+
+	oneofs := make(map[string]bool)
+	for _, field := range fields {
+		fieldGoName := makeNameUnique(goCamelCase(field.name), true)
+		if field.oneof != "" && !oneofs[field.oneof] {
+			oneofs[field.oneof] = true
+			makeNameUnique(goCamelCase(field.oneof), false)
+		}
+		if len(field.comments) == 0 {
+			continue
+		}
+		p.comments[goName+"."+fieldGoName] = field.comments
+
+		// oneof 字段会生成包装结构体, 如: type Msg_Field struct { Field string }
+		if field.oneof != "" {
+			wrapperName := goName + "_" + fieldGoName
+			for nestedNames[wrapperName] {
+				wrapperName += "_"
+			}
+			p.comments[wrapperName+"."+fieldGoName] = field.comments
+		}
+	}
+}
+
+// leadingComments 获取 tok 的前置注释, 和 tok 之间不能有空行
+func leadingComments(tok protoToken) []string {
+	var (
+		start    = len(tok.comments)
+		nextLine = tok.line
+	)
+	for i := len(tok.comments) - 1; i >= 0; i-- {
+		comment := tok.comments[i]
+		if comment.afterCode || comment.endLine != nextLine-1 {
+			break
+		}
+		start, nextLine = i, comment.line
+	}
+
+	comments := make([]string, 0, len(tok.comments)-start)
+	for _, comment := range tok.comments[start:] {
+		comments = append(comments, comment.text)
+	}
+	return comments
+}
+
+// trailingComments 获取和 tok 在同一行的行尾注释
+func (p *protoParser) trailingComments(tok protoToken) []string {
+	var comments []string
+	for _, comment := range p.peek().comments {
+		if comment.line == tok.line {
+			comments = append(comments, comment.text)
+		}
+	}
+	return comments
+}
+
+// skipStatement 跳过一个语句, 以 ; 结束或者为 {} 包裹的块
+func (p *protoParser) skipStatement() error {
+	var depth int
+	for !p.eof() {
+		tok := p.next()
+		if tok.isString {
+			continue
+		}
+		switch tok.text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				return nil
+			}
+		case ";":
+			if depth == 0 {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s: unexpected end of file", p.filename)
+}
+
+// eof 是否已到文件末尾, 最后一个词为文件末尾的占位
+func (p *protoParser) eof() bool {
+	return p.pos >= len(p.toks)-1
+}
+
+// next 获取下一个词
+func (p *protoParser) next() protoToken {
+	tok := p.toks[p.pos]
+	if !p.eof() {
+		p.pos++
+	}
+	return tok
+}
+
+// peek 查看下一个词
+func (p *protoParser) peek() protoToken {
+	return p.toks[p.pos]
+}
+
+// expect 下一个词必须为 text
+func (p *protoParser) expect(text string) error {
+	tok := p.next()
+	if tok.text != text || tok.isString {
+		return p.errorf(tok, "expected %q, got %q", text, tok.text)
+	}
+	return nil
+}
+
+// errorf 带位置的错误
+func (p *protoParser) errorf(tok protoToken, format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", p.filename, tok.line, fmt.Sprintf(format, args...))
+}
+
+// protoTokens 将 proto 源码拆分为词, 注释会挂在下一个词上, 末尾会追加一个空的词用于挂文件末尾的注释
+func protoTokens(filename string, src []byte) (toks []protoToken, err error) {
+	var (
+		line     = 1
+		lineCode bool // 当前行是否已有代码
+		comments []protoComment
+	)
+	addToken := func(text string, isString bool) {
+		toks = append(toks, protoToken{text: text, line: line, isString: isString, comments: comments})
+		comments = nil
+		lineCode = true
+	}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			lineCode = false
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			end := i
+			for end < len(src) && src[end] != '\n' {
+				end++
+			}
+			comments = append(comments, protoComment{text: strings.TrimRight(string(src[i:end]), "\r"), line: line, endLine: line, afterCode: lineCode})
+			i = end
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(string(src[i+2:]), "*/")
+			if end == -1 {
+				return nil, fmt.Errorf("%s:%d: comment is not closed", filename, line)
+			}
+			text := string(src[i : i+2+end+2])
+			comment := protoComment{text: text, line: line, afterCode: lineCode}
+			line += strings.Count(text, "\n")
+			comment.endLine = line
+			comments = append(comments, comment)
+			i += len(text)
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(src) && src[end] != c && src[end] != '\n' {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) || src[end] != c {
+				return nil, fmt.Errorf("%s:%d: string is not closed", filename, line)
+			}
+			addToken(string(src[i+1:end]), true)
+			i = end + 1
+		case isProtoWord(c):
+			end := i
+			for end < len(src) && isProtoWord(src[end]) {
+				end++
+			}
+			addToken(string(src[i:end]), false)
+			i = end
+		default:
+			addToken(string(c), false)
+			i++
+		}
+	}
+	addToken("", false)
+	return
+}
+
+// isProtoWord 是否为标识符, 数字或全名(如: google.protobuf.Any)中的字符
+func isProtoWord(c byte) bool {
+	return c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// goCamelCase 和 protoc-gen-go 一致, 将 proto 中的名字转为 go 的名字, 如: user_name => UserName, Outer.Inner => Outer_Inner
+func goCamelCase(s string) string {
+	isLower := func(c byte) bool { return 'a' <= c && c <= 'z' }
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '.' && i+1 < len(s) && isLower(s[i+1]):
+			// 跳过 .{{小写字母}} 中的 .
+		case c == '.':
+			b = append(b, '_')
+		case c == '_' && (i == 0 || s[i-1] == '.'):
+			b = append(b, 'X')
+		case c == '_' && i+1 < len(s) && isLower(s[i+1]):
+			// 跳过 _{{小写字母}} 中的 _
+		case '0' <= c && c <= '9':
+			b = append(b, c)
+		default:
+			if isLower(c) {
+				c -= 'a' - 'A'
+			}
+			b = append(b, c)
+			for ; i+1 < len(s) && isLower(s[i+1]); i++ {
+				b = append(b, s[i+1])
+			}
+		}
+	}
+	return string(b)
+}
+
+// MatchProto 在 protoFiles 中找到 go 源码对应的 proto 文件, 先按生成文件头部的 source 匹配, 再按文件名匹配(如: test.pb.go => test.proto)
+func MatchProto(goFilename string, src []byte, protoFiles []string) (string, bool) {
+	if source := ProtoSource(src); source != "" {
+		for _, protoFile := range protoFiles {
+			slashPath := filepath.ToSlash(filepath.Clean(protoFile))
+			if slashPath == source || strings.HasSuffix(slashPath, "/"+source) {
+				return protoFile, true
+			}
+		}
+	}
+
+	base := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(goFilename), ".go"), ".pb")
+	for _, protoFile := range protoFiles {
+		if strings.TrimSuffix(filepath.Base(protoFile), ".proto") == base {
+			return protoFile, true
+		}
+	}
+	return "", false
+}
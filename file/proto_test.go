@@ -0,0 +1,76 @@
+package file
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProtoSrc(t *testing.T) {
+	src := []byte(`syntax = "proto3";
+
+package test;
+
+option go_package = "./test";
+
+// 和 message 之间有空行, 不是前置注释
+
+// @valid either(Phone,Addr)
+message User {
+  // @tag valid:"required"
+  string user_name = 1; // @tag json:"un"
+  int32 age = 2 [json_name = "a"]; // @tag valid:"ge=1"
+  map<string, int32> scores = 3; /* @tag valid:"required" */
+  string descriptor = 4; // @tag valid:"to=1~3"
+
+  message Addr {
+    string city = 1; // @tag valid:"required"
+  }
+  enum Kind { KIND_A = 0; }
+  oneof contact {
+    string phone = 5; // @tag valid:"phone"
+    Addr addr = 6; // @tag valid:"required"
+  }
+  option (x.y) = { a: 1 };
+  reserved 10, 11;
+}
+
+service S { rpc A(User) returns (User) {} }
+`)
+	got, err := ParseProtoSrc("test.proto", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sure := FieldComments{
+		"User._":           {`// @valid either(Phone,Addr)`},
+		"User.UserName":    {`// @tag valid:"required"`, `// @tag json:"un"`},
+		"User.Age":         {`// @tag valid:"ge=1"`},
+		"User.Scores":      {`/* @tag valid:"required" */`},
+		"User.Descriptor_": {`// @tag valid:"to=1~3"`}, // 和生成的方法冲突
+		"User_Addr.City":   {`// @tag valid:"required"`},
+		"User.Phone":       {`// @tag valid:"phone"`},
+		"User_Phone.Phone": {`// @tag valid:"phone"`},
+		"User.Addr":        {`// @tag valid:"required"`},
+		"User_Addr_.Addr":  {`// @tag valid:"required"`}, // 包装结构体和嵌套 message 冲突
+	}
+	if !reflect.DeepEqual(got, sure) {
+		t.Errorf("got: %v", got)
+	}
+
+	if _, err = ParseProtoSrc("test.proto", []byte("message User {\n  string name = 1;\n")); err == nil {
+		t.Error("it should be failed")
+	}
+}
+
+func TestMatchProto(t *testing.T) {
+	protoFiles := []string{"proto/a/test.proto", "proto/b/test.proto", "proto/user.proto"}
+	src := []byte("// Code generated by protoc-gen-go. DO NOT EDIT.\n// source: b/test.proto\n\npackage test\n")
+	if got, ok := MatchProto("test.pb.go", src, protoFiles); !ok || got != "proto/b/test.proto" {
+		t.Error(got)
+	}
+	if got, ok := MatchProto("pb/user.pb.go", []byte("package pb\n"), protoFiles); !ok || got != "proto/user.proto" {
+		t.Error(got)
+	}
+	if got, ok := MatchProto("pb/order.pb.go", []byte("package pb\n"), protoFiles); ok {
+		t.Error(got)
+	}
+}
@@ -0,0 +1,467 @@
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gitee.com/xuesongtao/protoc-go-valid/valid"
+)
+
+const (
+	validateSuffix = "_validate.go" // 生成 Validate 方法的文件后缀
+)
+
+// 字段的类型, 用于生成不依赖反射的代码
+const (
+	kindString = "string"
+	kindInt    = "int"
+	kindUint   = "uint"
+	kindFloat  = "float"
+	kindBool   = "bool"
+	kindSlice  = "slice"
+	kindNil    = "nil"   // 可以和 nil 比较的类型, 如: 指针, map, interface
+	kindOther  = "other" // 其他类型, 如: 结构体, 数组, 其他包的类型
+)
+
+// ValidatePath 获取生成 Validate 方法的文件路径, 如: xxx.pb.go => xxx_validate.go
+func ValidatePath(inputPath string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(inputPath, ".go"), ".pb") + validateSuffix
+}
+
+// WriteValidate 生成 xxx_validate.go, 内容没有变化时不写文件, 没有需要验证的结构体时会删除已有的文件
+// 已有的 xxx_validate.go 不是本工具生成的时候会报错, 不会覆盖或删除
+func WriteValidate(inputPath string, areas []TextArea) (isChanged bool, err error) {
+	contents, err := GenValidate(inputPath, nil, areas)
+	if err != nil {
+		return
+	}
+	return writeGenFile(ValidatePath(inputPath), contents)
+}
+
+// DiffValidate 获取 xxx_validate.go 生成前后的 unified diff, 不写文件, 没有变化时 diff 为空
+func DiffValidate(inputPath string, areas []TextArea) (diff string, err error) {
+	contents, err := GenValidate(inputPath, nil, areas)
+	if err != nil {
+		return
+	}
+	return diffGenFile(ValidatePath(inputPath), contents)
+}
+
+// validateField 待生成验证代码的字段
+type validateField struct {
+	name  string
+	kind  string
+	typ   string // 类型的表达式, 如: int32, *Man
+	rules string
+}
+
+// validateGen 生成 Validate 方法
+type validateGen struct {
+	buf     *bytes.Buffer
+	imports map[string]bool // 用到的包
+}
+
+// GenValidate 根据结构体的 valid tag(包含 @tag 注入后的)生成不依赖反射的 func (m *X) Validate() error, 错误信息和 valid.Struct 一致
+// 1. required 和 to/oto/ge/le/gt/lt 对 string, 数字, 切片直接生成比较代码, either/botheq 直接生成判断代码
+// 2. 其他的规则和嵌套结构体通过 valid.ValidField 验证, 错误信息同样一致
+// 3. 不会使用 SetRule/SetGlobalRule 设置的规则; 匿名结构体和函数内的结构体会跳过
+// src 为 nil 时会读取 filename 的内容, 没有需要验证的结构体时返回 nil
+func GenValidate(filename string, src []byte, areas []TextArea) ([]byte, error) {
+	f, err := parseSrcFile(token.NewFileSet(), filename, src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// 注入后的 valid, key 为: 结构体名.字段名
+	injected := make(map[string]string, len(areas))
+	for _, area := range areas {
+		// 注入后没有 valid 时(如: @tag-remove valid)为空, 不能再使用原 tag 中的规则
+		rules := reflect.StructTag(area.FinalTag()).Get(validTagKey)
+		for _, name := range area.FieldNames {
+			injected[area.StructName+"."+name] = rules
+		}
+	}
+
+	// 同一个文件中声明的类型, 用于获取底层类型, 如: type Status int32
+	localTypes := make(map[string]ast.Expr)
+	typeSpecs := topTypeSpecs(f)
+	for _, typeSpec := range typeSpecs {
+		localTypes[typeSpec.Name.Name] = typeSpec.Type
+	}
+
+	gen := &validateGen{buf: new(bytes.Buffer), imports: map[string]bool{"errors": true, "strings": true}}
+	var hasStruct bool
+	for _, typeSpec := range typeSpecs {
+		structDecl, ok := typeSpec.Type.(*ast.StructType)
+		if !ok {
+			continue
+		}
+
+		structName := typeSpec.Name.Name
+		var (
+			fields      []validateField // 有验证规则的字段
+			allFields   []validateField // 所有可导出的字段, 结构体级别的规则中的字段可以没有 valid tag
+			structRules string
+		)
+		for _, field := range structDecl.Fields.List {
+			var tag string
+			if field.Tag != nil {
+				tag, _ = strconv.Unquote(field.Tag.Value)
+			}
+			for _, name := range fieldNames(field) {
+				rules, ok := injected[structName+"."+name]
+				if !ok {
+					rules = reflect.StructTag(tag).Get(validTagKey)
+				}
+				if name == valid.StructRuleField {
+					structRules = rules
+					continue
+				}
+				// 和 VStruct 一致, 跳过不可导出的字段和 time.Time
+				if !valid.IsExported(name) || isTimeType(field.Type) {
+					continue
+				}
+				vField := validateField{name: name, kind: typeKind(field.Type, localTypes, 0), typ: types.ExprString(field.Type), rules: rules}
+				allFields = append(allFields, vField)
+				if rules != "" {
+					fields = append(fields, vField)
+				}
+			}
+		}
+		// 结构体级别的规则还没有注入 _ 字段时
+		if structRules == "" {
+			structRules = injected[structName+"."+valid.StructRuleField]
+		}
+		if len(fields) == 0 && structRules == "" {
+			continue
+		}
+		hasStruct = true
+		gen.genStruct(structName, fields, allFields, structRules)
+	}
+	if !hasStruct {
+		return nil, nil
+	}
+
+	out := new(bytes.Buffer)
+	out.WriteString(genHeader)
+	fmt.Fprintf(out, "// source: %s\n\n", filepath.Base(filename))
+	fmt.Fprintf(out, "package %s\n\n", f.Name.Name)
+	out.WriteString("import (\n")
+	for _, pkg := range []string{"errors", "reflect", "strconv", "strings", "unicode/utf8"} {
+		if gen.imports[pkg] {
+			fmt.Fprintf(out, "%q\n", pkg)
+		}
+	}
+	fmt.Fprintf(out, "\n%q\n)\n", validPkgPath)
+	out.Write(gen.buf.Bytes())
+	return format.Source(out.Bytes())
+}
+
+// isTimeType 是否为 time.Time
+func isTimeType(expr ast.Expr) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && pkg.Name == "time" && sel.Sel.Name == "Time"
+}
+
+// typeKind 获取类型的种类, 同文件中声明的类型会取其底层类型
+func typeKind(expr ast.Expr, localTypes map[string]ast.Expr, depth int) string {
+	switch ty := expr.(type) {
+	case *ast.Ident:
+		switch ty.Name {
+		case "string":
+			return kindString
+		case "int", "int8", "int16", "int32", "int64", "rune":
+			return kindInt
+		case "uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte":
+			return kindUint
+		case "float32", "float64":
+			return kindFloat
+		case "bool":
+			return kindBool
+		}
+		if underlying, ok := localTypes[ty.Name]; ok && depth < 10 {
+			return typeKind(underlying, localTypes, depth+1)
+		}
+	case *ast.ArrayType:
+		if ty.Len == nil {
+			return kindSlice
+		}
+	case *ast.StarExpr, *ast.MapType, *ast.InterfaceType, *ast.ChanType, *ast.FuncType:
+		return kindNil
+	}
+	return kindOther
+}
+
+// isBasicKind 是否为可以直接生成比较代码的类型
+func isBasicKind(kind string) bool {
+	switch kind {
+	case kindString, kindInt, kindUint, kindFloat, kindBool:
+		return true
+	}
+	return false
+}
+
+// zeroExpr 判断字段是否为零值的表达式
+func (g *validateGen) zeroExpr(field validateField) string {
+	expr := "m." + field.name
+	switch field.kind {
+	case kindString:
+		return expr + ` == ""`
+	case kindInt, kindUint, kindFloat:
+		return expr + " == 0"
+	case kindBool:
+		return "!" + expr
+	case kindSlice, kindNil:
+		return expr + " == nil"
+	}
+	g.imports["reflect"] = true
+	return "reflect.ValueOf(" + expr + ").IsZero()"
+}
+
+// errStrExpr 生成 valid.GetJoinValidErrStr 的调用
+func errStrExpr(structName, fieldName, inputExpr string, others ...string) string {
+	args := []string{strconv.Quote(structName), strconv.Quote(fieldName), inputExpr}
+	for _, other := range others {
+		args = append(args, strconv.Quote(other))
+	}
+	return "errBuf.WriteString(valid.GetJoinValidErrStr(" + strings.Join(args, ", ") + "))\n"
+}
+
+// genStruct 生成单个结构体的 Validate 方法
+func (g *validateGen) genStruct(structName string, fields, allFields []validateField, structRules string) {
+	fmt.Fprintf(g.buf, "\n// Validate 验证 %s, 错误信息和 valid.Struct 一致\n", structName)
+	fmt.Fprintf(g.buf, "func (m *%s) Validate() error {\n", structName)
+	g.buf.WriteString("errBuf := new(strings.Builder)\n")
+
+	// either/botheq 的分组, 保持出现的顺序
+	groupNames := make([]string, 0, 2)
+	groups := make(map[string][]validateField)
+	addGroup := func(name string, field validateField) {
+		if _, ok := groups[name]; !ok {
+			groupNames = append(groupNames, name)
+		}
+		groups[name] = append(groups[name], field)
+	}
+
+	for _, field := range fields {
+		for _, rule := range valid.ValidNamesSplit(field.rules) {
+			if rule == "" {
+				continue
+			}
+			key, _, _ := valid.ParseValidNameKV(rule)
+			if key == valid.Either || key == valid.BothEq {
+				addGroup(rule, field)
+				continue
+			}
+			g.genRule(structName, field, rule)
+		}
+	}
+
+	// 结构体级别的规则
+	for _, rule := range valid.StructRulesSplit(structRules) {
+		if rule == "" {
+			continue
+		}
+		validName, fieldNames, err := valid.ParseStructRule(rule)
+		if err != nil {
+			fmt.Fprintf(g.buf, "errBuf.WriteString(valid.GetJoinFieldErr(%q, %q, %q))\n", structName, valid.StructRuleField, err.Error())
+			continue
+		}
+		groupName := validName + "=" + structName + "(" + strings.Join(fieldNames, ",") + ")"
+		for _, fieldName := range fieldNames {
+			field, ok := findField(allFields, fieldName)
+			if !ok {
+				fmt.Fprintf(g.buf, "errBuf.WriteString(valid.GetJoinFieldErr(%q, %q, %q))\n", structName, fieldName, "is not exist, struct rule: "+rule)
+				continue
+			}
+			addGroup(groupName, field)
+		}
+	}
+
+	for _, name := range groupNames {
+		g.genGroup(structName, name, groups[name])
+	}
+
+	g.buf.WriteString("if errBuf.Len() == 0 {\nreturn nil\n}\n")
+	g.buf.WriteString("return errors.New(strings.TrimSuffix(errBuf.String(), valid.ErrEndFlag))\n}\n")
+}
+
+// findField 根据字段名查找字段
+func findField(fields []validateField, name string) (validateField, bool) {
+	for _, field := range fields {
+		if field.name == name {
+			return field, true
+		}
+	}
+	return validateField{}, false
+}
+
+// genRule 生成单个规则的验证代码
+func (g *validateGen) genRule(structName string, field validateField, rule string) {
+	key, value, cusMsg := valid.ParseValidNameKV(rule)
+	switch key {
+	case valid.Required:
+		if !isBasicKind(field.kind) { // 集合和嵌套结构体需要验证里面的内容
+			break
+		}
+		fmt.Fprintf(g.buf, "if %s {\n", g.zeroExpr(field))
+		if cusMsg != "" {
+			g.buf.WriteString(errStrExpr(structName, field.name, `""`, cusMsg))
+		} else {
+			g.buf.WriteString(errStrExpr(structName, field.name, `""`, valid.ExplainEn, "it is", valid.Required))
+		}
+		g.buf.WriteString("}\n")
+		return
+	case valid.VTo, valid.VOTo, valid.VGe, valid.VLe, valid.VGt, valid.VLt:
+		if g.genSizeRule(structName, field, key, value, cusMsg) {
+			return
+		}
+	}
+
+	// 其他的规则按 VStruct 的方式验证
+	fmt.Fprintf(g.buf, "valid.ValidField(errBuf, %q, %q, %q, m.%s)\n", rule, structName, field.name, field.name)
+}
+
+// genSizeRule 生成 to/oto/ge/le/gt/lt 的验证代码, 和 valid 中 validInputSize 的判断一致, 不支持时返回 false
+func (g *validateGen) genSizeRule(structName string, field validateField, key, value, cusMsg string) bool {
+	var valExpr, inputExpr, unit string
+	fieldExpr := "m." + field.name
+	switch field.kind {
+	case kindString:
+		g.imports["unicode/utf8"] = true
+		valExpr, inputExpr, unit = "utf8.RuneCountInString("+fieldExpr+")", fieldExpr, "str-length"
+	case kindInt:
+		g.imports["strconv"] = true
+		valExpr, inputExpr, unit = "int64("+fieldExpr+")", "strconv.FormatInt(int64("+fieldExpr+"), 10)", "num-size"
+	case kindUint:
+		g.imports["strconv"] = true
+		valExpr, inputExpr, unit = "uint64("+fieldExpr+")", "strconv.FormatUint(uint64("+fieldExpr+"), 10)", "num-size"
+	case kindFloat:
+		g.imports["strconv"] = true
+		valExpr, inputExpr, unit = "float64("+fieldExpr+")", "strconv.FormatFloat(float64("+fieldExpr+"), 'f', -1, 64)", "num-size"
+	case kindSlice:
+		g.imports["strconv"] = true
+		valExpr, inputExpr, unit = "len("+fieldExpr+")", "strconv.Itoa(len("+fieldExpr+"))", "slice-len"
+	default:
+		return false
+	}
+
+	// 解析区间
+	var (
+		min, max           int
+		checkMin, checkMax bool
+		err                error
+	)
+	hasEqual := key == valid.VTo || key == valid.VGe || key == valid.VLe
+	switch key {
+	case valid.VTo, valid.VOTo:
+		minMax := strings.Split(value, "~")
+		if len(minMax) != 2 {
+			return false
+		}
+		if min, err = strconv.Atoi(minMax[0]); err != nil {
+			return false
+		}
+		if max, err = strconv.Atoi(minMax[1]); err != nil {
+			return false
+		}
+		checkMin, checkMax = true, true
+	case valid.VGe, valid.VGt:
+		min, _ = strconv.Atoi(value)
+		checkMin = true
+	case valid.VLe, valid.VLt:
+		max, _ = strconv.Atoi(value)
+		checkMax = true
+	}
+
+	// 和 validInputSize 一致, 开区间时 uint 和切片仍然按闭区间比较
+	lessOp, moreOp := "<", ">"
+	lessMsg, moreMsg := "it is less than", "it is more than"
+	if !hasEqual {
+		lessMsg, moreMsg = "it is less than or equal", "it is more than or equal"
+		if field.kind != kindUint && field.kind != kindSlice {
+			lessOp, moreOp = "<=", ">="
+		}
+	}
+
+	fmt.Fprintf(g.buf, "if !(%s) {\n", g.zeroExpr(field))
+	if checkMin {
+		fmt.Fprintf(g.buf, "if %s %s %d {\n", valExpr, lessOp, min)
+		if cusMsg != "" {
+			g.buf.WriteString(errStrExpr(structName, field.name, inputExpr, cusMsg))
+		} else {
+			g.buf.WriteString(errStrExpr(structName, field.name, inputExpr, valid.ExplainEn, lessMsg, strconv.Itoa(min), unit))
+		}
+		g.buf.WriteString("}")
+		// 有自定义错误时只输出一个
+		if checkMax && cusMsg != "" {
+			g.buf.WriteString(" else ")
+		} else {
+			g.buf.WriteString("\n")
+		}
+	}
+	if checkMax {
+		fmt.Fprintf(g.buf, "if %s %s %d {\n", valExpr, moreOp, max)
+		if cusMsg != "" {
+			g.buf.WriteString(errStrExpr(structName, field.name, inputExpr, cusMsg))
+		} else {
+			g.buf.WriteString(errStrExpr(structName, field.name, inputExpr, valid.ExplainEn, moreMsg, strconv.Itoa(max), unit))
+		}
+		g.buf.WriteString("}\n")
+	}
+	g.buf.WriteString("}\n")
+	return true
+}
+
+// genGroup 生成 either/botheq 的验证代码, 和 valid 中 either/bothEq 的判断一致
+func (g *validateGen) genGroup(structName, groupName string, fields []validateField) {
+	key, _, _ := valid.ParseValidNameKV(groupName)
+	if len(fields) == 1 {
+		// 只有一个字段时按 VStruct 的方式输出配置错误
+		field := fields[0]
+		fmt.Fprintf(g.buf, "valid.ValidField(errBuf, %q, %q, %q, m.%s)\n", groupName, structName, field.name, field.name)
+		return
+	}
+
+	names := make([]string, 0, len(fields))
+	for _, field := range fields {
+		names = append(names, `"`+structName+"."+field.name+`"`)
+	}
+	prefix := strings.Join(names, ", ") + " " + valid.ExplainEn
+
+	conds := make([]string, 0, len(fields))
+	if key == valid.Either {
+		for _, field := range fields {
+			conds = append(conds, g.zeroExpr(field))
+		}
+		fmt.Fprintf(g.buf, "if %s {\n", strings.Join(conds, " && "))
+		fmt.Fprintf(g.buf, "errBuf.WriteString(%q + valid.ErrEndFlag)\n", prefix+" they shouldn't all be empty")
+		g.buf.WriteString("}\n")
+		return
+	}
+
+	first := fields[0]
+	for _, field := range fields[1:] {
+		if isBasicKind(first.kind) && first.typ == field.typ {
+			conds = append(conds, "m."+first.name+" != m."+field.name)
+			continue
+		}
+		g.imports["reflect"] = true
+		conds = append(conds, "!reflect.DeepEqual(m."+first.name+", m."+field.name+")")
+	}
+	fmt.Fprintf(g.buf, "if %s {\n", strings.Join(conds, " || "))
+	fmt.Fprintf(g.buf, "errBuf.WriteString(%q + valid.ErrEndFlag)\n", prefix+" they should be equal")
+	g.buf.WriteString("}\n")
+}
@@ -0,0 +1,254 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGenValidate(t *testing.T) {
+	if got := ValidatePath("test/test.pb.go"); got != "test/test_validate.go" {
+		t.Error(got)
+	}
+
+	src := []byte("package test\n\n" +
+		"// @valid either(Name,Phone)\n" +
+		"type Man struct {\n" +
+		"\tName  string `json:\"name\"` // @tag valid:\"required,to=1~3\"\n" +
+		"\tPhone string // @tag valid:\"phone\"\n" +
+		"\tAge   int32  // @tag valid:\"ge=1|年龄不对\"\n" +
+		"}\n")
+	areas, err := ParseSrc("test.pb.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := GenValidate("test.pb.go", src, areas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sure := "// Code generated by protoc-go-valid. DO NOT EDIT.\n" +
+		"// source: test.pb.go\n" +
+		"\n" +
+		"package test\n" +
+		"\n" +
+		"import (\n" +
+		"\t\"errors\"\n" +
+		"\t\"strconv\"\n" +
+		"\t\"strings\"\n" +
+		"\t\"unicode/utf8\"\n" +
+		"\n" +
+		"\t\"gitee.com/xuesongtao/protoc-go-valid/valid\"\n" +
+		")\n" +
+		"\n" +
+		"// Validate 验证 Man, 错误信息和 valid.Struct 一致\n" +
+		"func (m *Man) Validate() error {\n" +
+		"\terrBuf := new(strings.Builder)\n" +
+		"\tif m.Name == \"\" {\n" +
+		"\t\terrBuf.WriteString(valid.GetJoinValidErrStr(\"Man\", \"Name\", \"\", \"explain:\", \"it is\", \"required\"))\n" +
+		"\t}\n" +
+		"\tif !(m.Name == \"\") {\n" +
+		"\t\tif utf8.RuneCountInString(m.Name) < 1 {\n" +
+		"\t\t\terrBuf.WriteString(valid.GetJoinValidErrStr(\"Man\", \"Name\", m.Name, \"explain:\", \"it is less than\", \"1\", \"str-length\"))\n" +
+		"\t\t}\n" +
+		"\t\tif utf8.RuneCountInString(m.Name) > 3 {\n" +
+		"\t\t\terrBuf.WriteString(valid.GetJoinValidErrStr(\"Man\", \"Name\", m.Name, \"explain:\", \"it is more than\", \"3\", \"str-length\"))\n" +
+		"\t\t}\n" +
+		"\t}\n" +
+		"\tvalid.ValidField(errBuf, \"phone\", \"Man\", \"Phone\", m.Phone)\n" +
+		"\tif !(m.Age == 0) {\n" +
+		"\t\tif int64(m.Age) < 1 {\n" +
+		"\t\t\terrBuf.WriteString(valid.GetJoinValidErrStr(\"Man\", \"Age\", strconv.FormatInt(int64(m.Age), 10), \"说明: 年龄不对\"))\n" +
+		"\t\t}\n" +
+		"\t}\n" +
+		"\tif m.Name == \"\" && m.Phone == \"\" {\n" +
+		"\t\terrBuf.WriteString(\"\\\"Man.Name\\\", \\\"Man.Phone\\\" explain: they shouldn't all be empty\" + valid.ErrEndFlag)\n" +
+		"\t}\n" +
+		"\tif errBuf.Len() == 0 {\n" +
+		"\t\treturn nil\n" +
+		"\t}\n" +
+		"\treturn errors.New(strings.TrimSuffix(errBuf.String(), valid.ErrEndFlag))\n" +
+		"}\n"
+	if string(got) != sure {
+		t.Error(string(got))
+	}
+
+	// 没有规则时不生成
+	if got, err = GenValidate("test.pb.go", []byte("package test\n\ntype Man struct {\n\tName string\n}\n"), nil); err != nil || got != nil {
+		t.Errorf("got: %s, err: %v", got, err)
+	}
+
+	// 删除 valid 后不再使用原 tag 中的规则
+	src = []byte("package test\n\ntype Man struct {\n\tName string `valid:\"required\"` // @tag-remove valid\n}\n")
+	if areas, err = ParseSrc("test.pb.go", src); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = GenValidate("test.pb.go", src, areas); err != nil || got != nil {
+		t.Errorf("got: %s, err: %v", got, err)
+	}
+}
+
+func TestWriteValidate(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "foo.go")
+	validatePath := ValidatePath(filename)
+	if err := ioutil.WriteFile(filename, []byte("package test\n\ntype Foo struct {\n\tName string\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 手写的 foo_validate.go 不会被删除
+	handWritten := []byte("package test\n\nfunc (f *Foo) Validate() error { return nil }\n")
+	if err := ioutil.WriteFile(validatePath, handWritten, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WriteValidate(filename, nil); err == nil {
+		t.Error("it should be failed")
+	}
+	if got, err := ioutil.ReadFile(validatePath); err != nil || string(got) != string(handWritten) {
+		t.Errorf("got: %s, err: %v", got, err)
+	}
+}
+
+// validateModel 用于比较 Validate 和 valid.Struct 的结构体
+const validateModel = `package model
+
+type Status int32
+
+type Inner struct {
+	No string // @tag valid:"required"
+}
+
+type Num struct {
+	Int     int      // @tag valid:"to=1~10"
+	Int8    int8     // @tag valid:"oto=1~10"
+	Uint    uint     // @tag valid:"oto=1~10"
+	Uint16  uint16   // @tag valid:"gt=2"
+	Uint64  uint64   // @tag valid:"lt=5"
+	Float   float64  // @tag valid:"ge=1"
+	Float32 float32  // @tag valid:"oto=1~5"
+	Str     string   // @tag valid:"to=2~4|长度需要在 2~4"
+	Runes   string   // @tag valid:"le=3"
+	Slice   []int    // @tag valid:"oto=1~3"
+	Strs    []string // @tag valid:"gt=1|数量不对"
+	Status  Status   // @tag valid:"lt=3"
+}
+
+// @valid either(OrderNo,TradeNo)
+type Order struct {
+	OrderNo string
+	TradeNo string
+	Inner   *Inner   // @tag valid:"required"
+	Inners  []*Inner // @tag valid:"required"
+	Name    string   // @tag valid:"required|名字必填"
+}
+`
+
+// validateMain 对每个输入比较 Validate 和 valid.Struct 的错误信息
+const validateMain = `package model
+
+import (
+	"fmt"
+	"os"
+
+	"gitee.com/xuesongtao/protoc-go-valid/valid"
+)
+
+var cases = []interface{ Validate() error }{
+	&Num{},
+	&Num{Int: 11, Int8: 1, Uint: 1, Uint16: 2, Uint64: 5, Float: 0.5, Float32: 1, Str: "a", Runes: "中文字符", Slice: []int{1}, Strs: []string{"a"}, Status: 3},
+	&Num{Int: 1, Int8: 10, Uint: 10, Uint16: 3, Uint64: 4, Float: 1, Float32: 5, Str: "ab", Runes: "中文", Slice: []int{1, 2, 3}, Strs: []string{"a", "b"}, Status: 2},
+	&Num{Int: -1, Int8: 5, Uint: 5, Uint16: 1, Uint64: 6, Float: -1.5, Float32: 5.5, Str: "abcde", Slice: []int{1, 2, 3, 4}, Strs: []string{"a", "b", "c"}, Status: -1},
+	&Num{Int: 10, Int8: 11, Uint: 11, Float: 0.99, Float32: 0.5, Str: "中文中文", Runes: "abcd", Slice: []int{}, Status: 1},
+	&Order{},
+	&Order{OrderNo: "1", Name: "x", Inner: &Inner{}, Inners: []*Inner{{}, {No: "1"}}},
+	&Order{TradeNo: "1", Name: "x", Inner: &Inner{No: "1"}, Inners: []*Inner{}},
+	&Order{OrderNo: "1", TradeNo: "1", Name: "x", Inner: &Inner{No: "1"}, Inners: []*Inner{{No: "1"}}},
+}
+
+func errStr(err error) string {
+	if err == nil {
+		return "<nil>"
+	}
+	return err.Error()
+}
+
+func Check() {
+	var failed, errNum int
+	for index, c := range cases {
+		got, sure := errStr(c.Validate()), errStr(valid.Struct(c))
+		if got != sure {
+			failed++
+			fmt.Printf("case %d %T:\n  Validate:     %s\n  valid.Struct: %s\n", index, c, got, sure)
+		}
+		if sure != "<nil>" {
+			errNum++
+		}
+	}
+	fmt.Printf("cases: %d, errors: %d, failed: %d\n", len(cases), errNum, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+`
+
+func TestGenValidateSameAsStruct(t *testing.T) {
+	if testing.Short() {
+		t.Skip("it needs to build the generated code")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not found")
+	}
+	root, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 生成的 Validate 和注入后的源码放到临时模块中编译
+	src := []byte(validateModel)
+	areas, err := ParseSrc("model.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validateSrc, err := GenValidate("model.go", src, areas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goSum, err := ioutil.ReadFile(filepath.Join(root, "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"go.mod":            []byte("module model\n\ngo 1.16\n\nrequire gitee.com/xuesongtao/protoc-go-valid v0.0.0\n\nreplace gitee.com/xuesongtao/protoc-go-valid => " + strconv.Quote(root) + "\n"),
+		"go.sum":            goSum,
+		"model.go":          Inject(src, areas),
+		"model_validate.go": validateSrc,
+		"check.go":          []byte(validateMain),
+		"cmd/main.go":       []byte("package main\n\nimport \"model\"\n\nfunc main() { model.Check() }\n"),
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(goBin, "run", "./cmd")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "failed: 0") || strings.Contains(string(out), "errors: 0") {
+		t.Error(string(out))
+	}
+	t.Log(strings.TrimSpace(string(out)))
+}
@@ -1,37 +1,153 @@
 package file
 
 import (
+	"bytes"
 	"errors"
+	"go/format"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"gitee.com/xuesongtao/protoc-go-valid/log"
 )
 
-func WriteFile(inputPath string, areas []textArea) (err error) {
+const (
+	backupSuffix = ".orig" // 备份文件的后缀
+)
+
+// WriteFile 将 areas 注入到文件中, isChanged 标记文件内容是否有变化
+// 内容没有变化时不写文件; 有变化时先写临时文件再重命名, 并保留原文件的权限
+// isBackup 为 true 时会将原内容保存到 inputPath.orig
+// inputPath 为软链接时会写到链接指向的文件, 权限也以指向的文件为准
+func WriteFile(inputPath string, areas []TextArea, isBackup ...bool) (isChanged bool, err error) {
+	realPath, err := filepath.EvalSymlinks(inputPath)
+	if err != nil {
+		return
+	}
+	info, err := os.Stat(realPath)
+	if err != nil {
+		return
+	}
+
+	contents, err := ReadFile(inputPath)
+	if err != nil {
+		return
+	}
+
+	injected := Inject(contents, areas)
+	if isChanged = !bytes.Equal(contents, injected); !isChanged {
+		return
+	}
+
+	if len(isBackup) > 0 && isBackup[0] {
+		if err = writeFileAtomic(inputPath+backupSuffix, contents, info.Mode().Perm()); err != nil {
+			return
+		}
+	}
+	err = writeFileAtomic(realPath, injected, info.Mode().Perm())
+	return
+}
+
+// writeFileAtomic 先在同目录下写临时文件, 再重命名为 filename, 避免写到一半时留下不完整的文件
+// filename 为软链接时写到链接指向的文件, 避免重命名时将软链接替换为普通文件
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) (err error) {
+	if realPath, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = realPath
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return
+	}
+	tmpName := tmp.Name()
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmpName)
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return
+	}
+
+	// 写盘
+	if err = tmp.Sync(); err != nil {
+		return
+	}
+
+	// 临时文件默认为 0600, 需要调整为原文件的权限
+	if err = tmp.Chmod(perm); err != nil {
+		return
+	}
+
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	err = os.Rename(tmpName, filename)
+	return
+}
+
+// DiffFile 获取注入前后的 unified diff, 不写文件, 没有变化时 diff 为空
+func DiffFile(inputPath string, areas []TextArea) (diff string, err error) {
+	contents, err := ReadFile(inputPath)
+	if err != nil {
+		return
+	}
+	diff = Diff(strings.TrimPrefix(filepath.ToSlash(filepath.Clean(inputPath)), "/"), contents, Inject(contents, areas))
+	return
+}
+
+// ReadFile 读取文件内容
+func ReadFile(inputPath string) (contents []byte, err error) {
 	f, err := os.Open(inputPath)
 	if err != nil {
 		return
 	}
 	defer f.Close()
 
-	contents, err := ioutil.ReadAll(f)
+	contents, err = ioutil.ReadAll(f)
+	return
+}
+
+// InjectSrc 解析 src 中的 @tag 并注入, 返回注入后的内容, 不依赖文件, filename 只用于解析时的错误信息
+func InjectSrc(filename string, src []byte, fieldComments ...FieldComments) ([]byte, error) {
+	areas, err := ParseSrc(filename, src, fieldComments...)
 	if err != nil {
-		return
+		return nil, err
 	}
+	return Inject(src, areas), nil
+}
 
+// Inject 将 areas 注入到 contents 中, 返回注入后的内容
+// 只有 tag 有变化时才会格式化, 避免改写没有注入内容的文件
+func Inject(contents []byte, areas []TextArea) []byte {
 	// 处理 contents, 首先从文件的尾部注入自定义标记以保持顺序
+	var isChanged bool
 	for i := 0; i < len(areas); i++ {
 		area := areas[len(areas)-i-1]
-		log.Infof("inject custom tag [%v] to expression [%v]", area.InjectTag, string(contents[area.Start-1:area.End-1]))
-		contents = injectTag(contents, area)
+		log.Infof("inject custom tag [%v] to field [%s.%s] tag [%v]", area.InjectTag, area.StructName, area.FieldName, area.CurrentTag)
+		if !area.IsInjected() {
+			contents = injectTag(contents, area)
+			isChanged = true
+		}
 	}
+	if !isChanged {
+		return contents
+	}
+	return formatSrc(contents)
+}
 
-	if err = ioutil.WriteFile(inputPath, contents, 0644); err != nil {
-		return
+// formatSrc 注入后 tag 的长度变化会导致结构体的列对齐和 gofmt 不一致, 这里统一格式化
+// 如果格式化失败(如: 内容不是合法的 go 代码), 就返回原内容
+func formatSrc(contents []byte) []byte {
+	formatted, err := format.Source(contents)
+	if err != nil {
+		log.Errorf("format.Source is failed, err: %v", err)
+		return contents
 	}
-	return
+	return formatted
 }
 
 // CopyFile 复制文件
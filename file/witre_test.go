@@ -0,0 +1,161 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test.pb.go")
+	src := "package test\n\ntype Man struct {\n\tName string // @tag valid:\"required\"\n}\n"
+	if err := ioutil.WriteFile(filename, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	areas, err := ParseFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	isChanged, err := WriteFile(filename, areas, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isChanged {
+		t.Error("file should be changed")
+	}
+
+	// 权限保持不变
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("file mode is not ok: %v", info.Mode().Perm())
+	}
+
+	// 备份为原内容
+	backup, err := ioutil.ReadFile(filename + backupSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(backup) != src {
+		t.Errorf("backup is not ok: %s", backup)
+	}
+
+	// 再次注入内容不变时不写文件, 也不留临时文件
+	areas, err = ParseFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isChanged, err = WriteFile(filename, areas); err != nil || isChanged {
+		t.Errorf("file should not be changed, err: %v", err)
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("dir has unexpected files: %d", len(entries))
+	}
+}
+
+func TestInjectFormat(t *testing.T) {
+	src := []byte("package test\n\ntype Man struct {\n" +
+		"\tName string // @tag valid:\"required\"\n" +
+		"\tAge  int    // @tag valid:\"ge=1\"\n" +
+		"}\n")
+	areas, err := ParseSrc("test.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sure := "package test\n\ntype Man struct {\n" +
+		"\tName string `valid:\"required\"` // @tag valid:\"required\"\n" +
+		"\tAge  int    `valid:\"ge=1\"`     // @tag valid:\"ge=1\"\n" +
+		"}\n"
+	if got := string(Inject(src, areas)); got != sure {
+		t.Error(got)
+	}
+}
+
+func TestInjectNotFormat(t *testing.T) {
+	// 没有需要注入的 tag 时保持原样, 不进行格式化
+	src := []byte("package test\n\ntype Man struct {\n" +
+		"\tName string `valid:\"required\"` // @tag valid:\"required\"\n" +
+		"\tAge int\n" +
+		"}\n")
+	areas, err := ParseSrc("test.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(Inject(src, areas)); got != string(src) {
+		t.Error(got)
+	}
+
+	filename := filepath.Join(t.TempDir(), "test.go")
+	if err := ioutil.WriteFile(filename, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if areas, err = ParseFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	isChanged, err := WriteFile(filename, areas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isChanged {
+		t.Error("unformatted file without new tag should not be changed")
+	}
+}
+
+func TestWriteFileSymlink(t *testing.T) {
+	dir := t.TempDir()
+	realPath := filepath.Join(dir, "real", "a.go")
+	linkPath := filepath.Join(dir, "d", "a.go")
+	for _, path := range []string{realPath, linkPath} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src := "package test\n\ntype Man struct {\n\tName string // @tag valid:\"required\"\n}\n"
+	if err := ioutil.WriteFile(realPath, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..", "real", "a.go"), linkPath); err != nil {
+		t.Skip("symlink is not supported: ", err)
+	}
+
+	areas, err := ParseFile(linkPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isChanged, err := WriteFile(linkPath, areas); err != nil || !isChanged {
+		t.Fatalf("isChanged: %v, err: %v", isChanged, err)
+	}
+
+	// 软链接保持不变, 写到链接指向的文件, 权限以指向的文件为准
+	info, err := os.Lstat(linkPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Error("symlink is replaced")
+	}
+	got, err := ioutil.ReadFile(realPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "`valid:\"required\"`") {
+		t.Error(string(got))
+	}
+	if info, err = os.Stat(realPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("file mode is not ok: %v, err: %v", info.Mode().Perm(), err)
+	}
+	entries, err := ioutil.ReadDir(filepath.Dir(realPath))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("dir has unexpected files: %v, err: %v", entries, err)
+	}
+}
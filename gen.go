@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"gitee.com/xuesongtao/protoc-go-valid/file"
+	"gitee.com/xuesongtao/protoc-go-valid/log"
+	"gopkg.in/yaml.v3"
+)
+
+// 默认的配置文件, 按顺序在当前目录查找
+var defaultConfigFiles = []string{"protoc-go-valid.yaml", "protoc-go-valid.yml", "protoc-go-valid.json"}
+
+// configTemplate gen -init 生成的配置文件
+const configTemplate = `# protoc-go-valid gen 的配置, 路径都相对于配置文件所在的目录
+protoc: protoc # protoc 命令
+protoc_args: # 其他 protoc 参数
+  - --go_opt=paths=source_relative
+targets: # proto 源文件目录和生成 pb.go 的目录
+  - proto_dir: proto
+    out_dir: protogo
+merge: replace # key 重复时的合并策略, 如: union, valid=union,json=replace
+markers: [] # 注释中注入 tag 的标识, 为空时为 @tag, 如: ["@tag", "@valid=valid"]
+macros: [] # 规则宏文件, 注释中通过 valid:"$宏名" 引用
+include: # 需要注入的文件匹配规则
+  - "*.pb.go"
+exclude: [] # 需要跳过的文件/目录匹配规则
+from_proto: false # 是否直接从 proto 源文件读取注释
+companion: false # 不修改 pb.go, 生成伴生文件 xxx_valid.go 注册规则
+gen_validate: false # 额外生成 xxx_validate.go, 包含不依赖反射的 Validate 方法
+strict: false # 存在不合法的验证规则时按处理失败处理, 不会写文件
+`
+
+// genTarget 一组 proto 源文件目录和生成 pb.go 的目录
+type genTarget struct {
+	ProtoDir string `json:"proto_dir" yaml:"proto_dir"` // proto 源文件目录, 会递归查找 *.proto, 同时作为 protoc 的 -I
+	OutDir   string `json:"out_dir" yaml:"out_dir"`     // 生成 pb.go 的目录, 即 --go_out
+}
+
+// genConfig 项目配置, 对应项目根目录下的 protoc-go-valid.yaml 或 protoc-go-valid.json
+type genConfig struct {
+	Protoc      string      `json:"protoc" yaml:"protoc"`             // protoc 命令, 默认为 protoc
+	ProtocArgs  []string    `json:"protoc_args" yaml:"protoc_args"`   // 其他 protoc 参数, 如: --go_opt=paths=source_relative
+	Targets     []genTarget `json:"targets" yaml:"targets"`           // proto 源文件目录和生成 pb.go 的目录
+	Merge       string      `json:"merge" yaml:"merge"`               // key 重复时的合并策略, 同 -merge
+	Markers     []string    `json:"markers" yaml:"markers"`           // 注释中注入 tag 的标识, 同 -marker
+	Macros      []string    `json:"macros" yaml:"macros"`             // 规则宏文件, 同 -macro
+	Includes    []string    `json:"include" yaml:"include"`           // 需要注入的文件匹配规则, 同 -include
+	Excludes    []string    `json:"exclude" yaml:"exclude"`           // 需要跳过的文件/目录匹配规则, 同 -exclude, 对 proto 文件同样生效
+	FromProto   bool        `json:"from_proto" yaml:"from_proto"`     // 是否直接从 proto 源文件读取注释, 同 -proto
+	Companion   bool        `json:"companion" yaml:"companion"`       // 不修改 pb.go, 生成伴生文件 xxx_valid.go, 同 -companion
+	GenValidate bool        `json:"gen_validate" yaml:"gen_validate"` // 额外生成 xxx_validate.go, 同 -gen-validate
+	Strict      bool        `json:"strict" yaml:"strict"`             // 存在不合法的验证规则时按处理失败处理, 同 -strict
+}
+
+// loadConfig 加载配置文件, 根据后缀使用 yaml 或 json 解析, 相对路径都转为相对于配置文件所在的目录
+func loadConfig(configPath string) (*genConfig, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := new(genConfig)
+	switch filepath.Ext(configPath) {
+	case ".json":
+		err = json.Unmarshal(data, cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	default:
+		return nil, fmt.Errorf("config %q is not supported, it should be .yaml, .yml or .json", configPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config %q is failed, err: %v", configPath, err)
+	}
+
+	if cfg.Protoc == "" {
+		cfg.Protoc = "protoc"
+	}
+	if len(cfg.Targets) == 0 {
+		return nil, fmt.Errorf("config %q targets is empty", configPath)
+	}
+	baseDir := filepath.Dir(configPath)
+	for index, macroFile := range cfg.Macros {
+		cfg.Macros[index] = joinPath(baseDir, macroFile)
+	}
+	for index, target := range cfg.Targets {
+		if target.ProtoDir == "" || target.OutDir == "" {
+			return nil, fmt.Errorf("config %q targets[%d] proto_dir and out_dir are required", configPath, index)
+		}
+		cfg.Targets[index].ProtoDir = joinPath(baseDir, target.ProtoDir)
+		cfg.Targets[index].OutDir = joinPath(baseDir, target.OutDir)
+	}
+	return cfg, nil
+}
+
+// joinPath path 为相对路径时拼接到 baseDir 下
+func joinPath(baseDir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
+
+// findConfig 在当前目录查找默认的配置文件
+func findConfig() (string, error) {
+	for _, configPath := range defaultConfigFiles {
+		if _, err := os.Stat(configPath); err == nil {
+			return configPath, nil
+		}
+	}
+	return "", fmt.Errorf("it is not found config file %s, it can be created by: protoc-go-valid gen -init", strings.Join(defaultConfigFiles, "/"))
+}
+
+// collectProtos 递归获取目录下的 proto 文件, 会跳过 excludes 匹配到的文件和目录
+func collectProtos(protoDir string, excludes []string) (protoFiles []string, err error) {
+	err = filepath.WalkDir(protoDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != protoDir && matchGlobs(excludes, path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".proto") {
+			protoFiles = append(protoFiles, path)
+		}
+		return nil
+	})
+	return
+}
+
+// runProtoc 执行 protoc 生成 pb.go, 输出直接打印到终端
+func runProtoc(cfg *genConfig, target genTarget, protoFiles []string) error {
+	if err := os.MkdirAll(target.OutDir, 0755); err != nil {
+		return err
+	}
+
+	args := make([]string, 0, len(cfg.ProtocArgs)+len(protoFiles)+2)
+	args = append(args, "-I"+target.ProtoDir, "--go_out="+target.OutDir)
+	args = append(args, cfg.ProtocArgs...)
+	args = append(args, protoFiles...)
+	log.Infof("exec: %s %s", cfg.Protoc, strings.Join(args, " "))
+
+	cmd := exec.Command(cfg.Protoc, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("exec %s is failed, err: %v", cfg.Protoc, err)
+	}
+	return nil
+}
+
+// runGen 执行 gen 子命令, 根据配置文件执行 protoc 后注入 tag, 替代 inject_tool.sh
+func runGen(args []string) {
+	var (
+		flags      = flag.NewFlagSet("gen", flag.ExitOnError)
+		configPath string
+		initConfig bool
+		skipProtoc bool
+		jobs       int
+	)
+	flags.StringVar(&configPath, "config", "", "配置文件, 默认在当前目录查找 "+strings.Join(defaultConfigFiles, "/")+", 如: protoc-go-valid gen -config \"./protoc-go-valid.yaml\"")
+	flags.BoolVar(&initConfig, "init", false, "在当前目录生成配置文件 protoc-go-valid.yaml, 如: protoc-go-valid gen -init")
+	flags.BoolVar(&skipProtoc, "skip-protoc", false, "不执行 protoc, 只对已生成的 pb.go 注入 tag, 如: protoc-go-valid gen -skip-protoc")
+	flags.IntVar(&jobs, "j", runtime.NumCPU(), "并发处理的文件数, 如: protoc-go-valid gen -j 8")
+	_ = flags.Parse(args)
+
+	if initConfig {
+		if _, err := os.Stat(defaultConfigFiles[0]); err == nil {
+			log.Fatalf("config %q is exist", defaultConfigFiles[0])
+		}
+		if err := os.WriteFile(defaultConfigFiles[0], []byte(configTemplate), 0644); err != nil {
+			log.Fatal("write config is failed, err: ", err)
+		}
+		log.Infof("config %q is created", defaultConfigFiles[0])
+		return
+	}
+
+	if configPath == "" {
+		var err error
+		if configPath, err = findConfig(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := file.SetMergePolicy(cfg.Merge); err != nil {
+		log.Fatal("file.SetMergePolicy is failed, err: ", err)
+	}
+	if len(cfg.Markers) > 0 {
+		if err := file.SetMarkers(cfg.Markers...); err != nil {
+			log.Fatal("file.SetMarkers is failed, err: ", err)
+		}
+	}
+	for _, macroFile := range cfg.Macros {
+		if err := file.LoadMacroFile(macroFile); err != nil {
+			log.Fatal("file.LoadMacroFile is failed, err: ", err)
+		}
+	}
+
+	inject := &injector{
+		recursive:   true,
+		companion:   cfg.Companion,
+		genValidate: cfg.GenValidate,
+		strict:      cfg.Strict,
+		jobs:        jobs,
+		includes:    cfg.Includes,
+		excludes:    cfg.Excludes,
+	}
+	var filenames []string
+	for _, target := range cfg.Targets {
+		protoFiles, err := collectProtos(target.ProtoDir, cfg.Excludes)
+		if err != nil {
+			log.Fatalf("collect proto files in %q is failed, err: %v", target.ProtoDir, err)
+		}
+		if len(protoFiles) == 0 {
+			log.Warningf("it is not found proto files in %q", target.ProtoDir)
+			continue
+		}
+		if !skipProtoc {
+			if err := runProtoc(cfg, target, protoFiles); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if cfg.FromProto {
+			inject.protoFiles = append(inject.protoFiles, protoFiles...)
+		}
+
+		targetFiles, err := inject.collectDir(target.OutDir)
+		if err != nil {
+			log.Fatalf("collect files in %q is failed, err: %v", target.OutDir, err)
+		}
+		filenames = append(filenames, targetFiles...)
+	}
+
+	if len(filenames) == 0 {
+		log.Error("it is not matched files, see: protoc-go-valid gen -help")
+		os.Exit(1)
+	}
+	inject.report(inject.run(filenames))
+	if inject.isFailed() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitee.com/xuesongtao/protoc-go-valid/file"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	absOut := filepath.Join(dir, "abs")
+	writeTree(t, dir, map[string]string{
+		"yaml/protoc-go-valid.yaml": "targets:\n  - proto_dir: proto\n    out_dir: protogo\nmacros: [valid.macro]\ncompanion: true\nstrict: true\ngen_validate: true\n",
+		"json/protoc-go-valid.json": `{"protoc": "/usr/bin/protoc", "targets": [{"proto_dir": "proto", "out_dir": "` + filepath.ToSlash(absOut) + `"}], "from_proto": true}`,
+		"empty/protoc-go-valid.yml": "merge: union\n",
+		"miss/protoc-go-valid.yaml": "targets:\n  - proto_dir: proto\n",
+		"bad/protoc-go-valid.yaml":  "targets: [\n",
+		"ext/protoc-go-valid.toml":  "",
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		sure   *genConfig
+		hasErr bool
+	}{
+		{
+			name: "yaml",
+			path: "yaml/protoc-go-valid.yaml",
+			sure: &genConfig{
+				Protoc:      "protoc",
+				Targets:     []genTarget{{ProtoDir: filepath.Join(dir, "yaml/proto"), OutDir: filepath.Join(dir, "yaml/protogo")}},
+				Macros:      []string{filepath.Join(dir, "yaml/valid.macro")},
+				Companion:   true,
+				GenValidate: true,
+				Strict:      true,
+			},
+		},
+		{
+			name: "json",
+			path: "json/protoc-go-valid.json",
+			sure: &genConfig{
+				Protoc:    "/usr/bin/protoc",
+				Targets:   []genTarget{{ProtoDir: filepath.Join(dir, "json/proto"), OutDir: absOut}},
+				FromProto: true,
+			},
+		},
+		{name: "targets is empty", path: "empty/protoc-go-valid.yml", hasErr: true},
+		{name: "out_dir is missing", path: "miss/protoc-go-valid.yaml", hasErr: true},
+		{name: "parse failed", path: "bad/protoc-go-valid.yaml", hasErr: true},
+		{name: "ext not supported", path: "ext/protoc-go-valid.toml", hasErr: true},
+		{name: "not exist", path: "none/protoc-go-valid.yaml", hasErr: true},
+	}
+	for _, test := range tests {
+		cfg, err := loadConfig(filepath.Join(dir, test.path))
+		if test.hasErr {
+			if err == nil {
+				t.Errorf("%s: it should be failed", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(cfg, test.sure) {
+			t.Errorf("%s: got %+v, sure: %+v", test.name, cfg, test.sure)
+		}
+	}
+}
+
+func TestCollectProtos(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a.proto":              "",
+		"a.pb.go":              "",
+		"user/b.proto":         "",
+		"user/old/c.proto":     "",
+		"third_party/d.proto":  "",
+		"google/api/e.proto":   "",
+		"google/api/README.md": "",
+	})
+
+	tests := []struct {
+		excludes []string
+		sure     []string
+	}{
+		{
+			sure: []string{"a.proto", "google/api/e.proto", "third_party/d.proto", "user/b.proto", "user/old/c.proto"},
+		},
+		{
+			excludes: []string{"third_party/", "google", "old", "b.proto"},
+			sure:     []string{"a.proto"},
+		},
+		{
+			excludes: []string{"*.proto"},
+			sure:     []string{},
+		},
+	}
+	for _, test := range tests {
+		protoFiles, err := collectProtos(dir, test.excludes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := relPaths(t, dir, protoFiles); !reflect.DeepEqual(got, test.sure) {
+			t.Errorf("excludes %v: got %v, sure: %v", test.excludes, got, test.sure)
+		}
+	}
+}
+
+func TestRunGenSkipProtoc(t *testing.T) {
+	dir := t.TempDir()
+	pbSrc := "package user\n\ntype User struct {\n\tName string `json:\"name\"` // @tag valid:\"required\"\n}\n"
+	writeTree(t, dir, map[string]string{
+		"protoc-go-valid.yaml":  "protoc: protoc-not-exist\ntargets:\n  - proto_dir: proto\n    out_dir: protogo\ninclude: [\"*.pb.go\"]\nexclude: [\"old/\"]\n",
+		"proto/user.proto":      "syntax = \"proto3\";\n",
+		"protogo/user.pb.go":    pbSrc,
+		"protogo/user.go":       pbSrc,
+		"protogo/old/old.pb.go": pbSrc,
+	})
+	defer func() { _ = file.SetMergePolicy("") }()
+
+	// 不执行 protoc, 所以 protoc 不存在也不影响
+	runGen([]string{"-config", filepath.Join(dir, "protoc-go-valid.yaml"), "-skip-protoc", "-j", "1"})
+
+	sure := strings.Replace(pbSrc, "`json:\"name\"`", "`json:\"name\" valid:\"required\"`", 1)
+	tests := []struct {
+		path string
+		sure string
+	}{
+		{path: "protogo/user.pb.go", sure: sure},
+		{path: "protogo/user.go", sure: pbSrc},       // 不匹配 include
+		{path: "protogo/old/old.pb.go", sure: pbSrc}, // 匹配 exclude
+	}
+	for _, test := range tests {
+		got, err := ioutil.ReadFile(filepath.Join(dir, test.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.sure {
+			t.Errorf("%s: %s", test.path, got)
+		}
+	}
+}
@@ -1,3 +1,8 @@
 module gitee.com/xuesongtao/protoc-go-valid
 
 go 1.16
+
+require (
+	google.golang.org/protobuf v1.28.1 // 固定版本, cmd/protoc-gen-go-valid 依赖 internal_gengo, 升级时需要同步 protocGenGoVersion
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,606 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gitee.com/xuesongtao/protoc-go-valid/file"
+	"gitee.com/xuesongtao/protoc-go-valid/log"
+)
+
+// 单个文件的处理状态
+const (
+	statusChanged   = "changed"
+	statusUnchanged = "unchanged"
+	statusError     = "error"
+)
+
+const (
+	reportJson    = "json"    // 以 json 格式输出处理结果
+	stdinFilename = "<stdin>" // -stdin 时源码的文件名
+)
+
+// injector 注入执行体
+type injector struct {
+	recursive     bool                          // 是否递归处理子目录
+	dryRun        bool                          // 只输出 diff, 不写文件
+	check         bool                          // 只检查是否已注入, 不写文件
+	backup        bool                          // 写文件前是否将原内容备份为 .orig
+	companion     bool                          // 不修改源文件, 生成伴生文件 xxx_valid.go 注册规则
+	genValidate   bool                          // 额外生成 xxx_validate.go, 包含不依赖反射的 Validate 方法
+	jobs          int                           // 并发处理的文件数
+	includes      []string                      // 需要处理的文件匹配规则, 如: *.pb.go
+	excludes      []string                      // 需要跳过的文件/目录匹配规则, 如: vendor, testdata
+	buildTags     []string                      // 按包处理时的构建标签
+	strict        bool                          // 存在不合法的验证规则时, 文件按处理失败处理, 不会写文件
+	reportFormat  string                        // 处理结果的输出格式, 为 json 时会输出每个字段的变更
+	protoFiles    []string                      // proto 源文件, 设置后字段的注释以匹配到的 proto 文件为准
+	protoComments map[string]file.FieldComments // proto 文件中的注释, key 为 proto 文件路径
+	summary       summary                       // 处理结果汇总
+}
+
+// summary 处理结果汇总
+type summary struct {
+	scanned int // 扫描的文件数
+	changed int // 有变更的文件数
+	failed  int // 处理失败的文件数
+	missing int // 未注入的字段数, 用于 check 模式
+	invalid int // 不合法的验证规则数
+}
+
+// tagChange 字段 tag 的变更
+type tagChange struct {
+	File      string `json:"file"`
+	Struct    string `json:"struct"`
+	Field     string `json:"field"`
+	Line      int    `json:"line"`
+	OldTag    string `json:"old_tag"`
+	InjectTag string `json:"inject_tag"`
+	FinalTag  string `json:"final_tag"`
+}
+
+// jsonReport json 格式的处理结果
+type jsonReport struct {
+	Changes []tagChange `json:"changes"`
+	Summary struct {
+		Scanned   int `json:"scanned"`
+		Changed   int `json:"changed"`
+		Unchanged int `json:"unchanged"`
+		Failed    int `json:"failed"`
+		Missing   int `json:"missing"`
+		Invalid   int `json:"invalid"`
+	} `json:"summary"`
+}
+
+// fileResult 单个文件的处理结果
+type fileResult struct {
+	filename string
+	status   string      // changed/unchanged/error, check 模式下 changed 表示有未注入的字段
+	missing  int         // 未注入的字段数, 用于 check 模式
+	invalids []string    // 不合法的验证规则, 格式为: file:line: xxx
+	output   string      // 需要输出到 stdout 的内容, 如: diff, 未注入的字段
+	changes  []tagChange // 有变更的字段
+	err      error
+}
+
+// splitGlobs 将逗号隔开的匹配规则进行分割
+func splitGlobs(globs string) []string {
+	res := make([]string, 0, 2)
+	for _, glob := range strings.Split(globs, ",") {
+		glob = strings.TrimSpace(glob)
+		if glob == "" {
+			continue
+		}
+		res = append(res, glob)
+	}
+	return res
+}
+
+// expandGlobs 展开匹配规则中的通配符, 没有匹配到文件时报错
+func expandGlobs(globs []string) ([]string, error) {
+	res := make([]string, 0, len(globs))
+	for _, glob := range globs {
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			return nil, fmt.Errorf("filepath.Glob %q is failed, err: %v", glob, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%q is not matched any file", glob)
+		}
+		res = append(res, matches...)
+	}
+	return res, nil
+}
+
+// matchGlobs 判断 name 是否匹配其中一个规则, 会分别按名字和路径进行匹配
+// 目录的规则可以以 / 结尾, 如: vendor/ 会跳过所有的 vendor 目录
+func matchGlobs(globs []string, path string) bool {
+	name := filepath.Base(path)
+	path = filepath.ToSlash(path)
+	for _, glob := range globs {
+		if glob = strings.TrimSuffix(glob, "/"); glob == "" {
+			continue
+		}
+		if ok, _ := filepath.Match(glob, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(glob, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isExclude 是否需要跳过
+func (i *injector) isExclude(path string) bool {
+	return matchGlobs(i.excludes, path)
+}
+
+// isInclude 是否需要处理, 没有设置 includes 时都处理
+func (i *injector) isInclude(path string) bool {
+	if len(i.includes) == 0 {
+		return true
+	}
+	return matchGlobs(i.includes, path)
+}
+
+// isGoFile 是否为需要处理的 .go 文件, 本工具生成的 xxx_valid.go 和 xxx_validate.go 不处理
+func (i *injector) isGoFile(path string) bool {
+	return strings.HasSuffix(path, ".go") && !i.isExclude(path) && i.isInclude(path) && !file.IsGenFile(path)
+}
+
+// collectDir 按目录获取待处理的文件, 如果设置了 recursive 会处理所有的子目录
+func (i *injector) collectDir(dirPath string) (filenames []string, err error) {
+	err = filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if path == dirPath {
+				return nil
+			}
+			if !i.recursive || i.isExclude(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if i.isGoFile(path) {
+			filenames = append(filenames, path)
+		}
+		return nil
+	})
+	return
+}
+
+// collectPatternFiles 根据路径表达式获取待处理的文件
+func (i *injector) collectPatternFiles(pattern string) (filenames []string, err error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return
+	}
+
+	for _, filename := range matches {
+		if i.isGoFile(filename) {
+			filenames = append(filenames, filename)
+		}
+	}
+	return
+}
+
+// collectPackages 根据包路径获取待处理的文件, 支持 ./api/... 的形式, 会按构建标签过滤并跳过测试文件
+func (i *injector) collectPackages(patterns []string) (filenames []string, err error) {
+	ctx := build.Default
+	ctx.BuildTags = i.buildTags
+	for _, pattern := range patterns {
+		root, isRecursive := pattern, false
+		if pattern == "..." || strings.HasSuffix(pattern, "/...") {
+			root, isRecursive = strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/"), true
+			if root == "" {
+				root = "."
+			}
+		}
+
+		if !isRecursive {
+			var files []string
+			if files, err = i.packageFiles(&ctx, root); err != nil {
+				return
+			}
+			if len(files) == 0 {
+				err = fmt.Errorf("package %q has no go files", pattern)
+				return
+			}
+			filenames = append(filenames, files...)
+			continue
+		}
+
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				return nil
+			}
+
+			// 和 go 命令一致, 跳过 testdata, vendor 和以 . 或 _ 开头的目录
+			name := d.Name()
+			if path != root && (name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || i.isExclude(path)) {
+				return filepath.SkipDir
+			}
+			files, err := i.packageFiles(&ctx, path)
+			if err != nil {
+				return err
+			}
+			filenames = append(filenames, files...)
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// packageFiles 获取目录下满足构建标签的非测试 go 文件, 目录下没有 go 文件时返回空
+func (i *injector) packageFiles(ctx *build.Context, dir string) (filenames []string, err error) {
+	pkg, err := ctx.ImportDir(dir, 0)
+	if err != nil {
+		if _, ok := err.(*build.NoGoError); ok {
+			err = nil
+		}
+		return
+	}
+
+	for _, name := range append(pkg.GoFiles, pkg.CgoFiles...) {
+		filename := filepath.Join(dir, name)
+		if i.isGoFile(filename) {
+			filenames = append(filenames, filename)
+		}
+	}
+	return
+}
+
+// collectFile 获取单个待处理的文件
+func (i *injector) collectFile(filename string) []string {
+	// 只处理 .go 文件
+	if !strings.HasSuffix(filename, ".go") {
+		return nil
+	}
+	return []string{filename}
+}
+
+// run 并发处理文件, 结果的顺序和 filenames 一致
+func (i *injector) run(filenames []string) []fileResult {
+	jobs := i.jobs
+	if jobs <= 0 {
+		jobs = 1
+	}
+
+	results := make([]fileResult, len(filenames))
+	if err := i.loadProtos(); err != nil {
+		for index, filename := range filenames {
+			results[index] = fileResult{filename: filename, status: statusError, err: err}
+		}
+		return results
+	}
+
+	indexCh := make(chan int, jobs)
+	var wg sync.WaitGroup
+	for j := 0; j < jobs; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexCh {
+				results[index] = i.handleFile(filenames[index])
+			}
+		}()
+	}
+
+	for index := range filenames {
+		indexCh <- index
+	}
+	close(indexCh)
+	wg.Wait()
+	return results
+}
+
+// loadProtos 解析 proto 源文件中的注释, 每次执行时都会重新解析, 所以 watch 模式下修改 proto 也会生效
+func (i *injector) loadProtos() error {
+	if len(i.protoFiles) == 0 {
+		return nil
+	}
+
+	protoComments := make(map[string]file.FieldComments, len(i.protoFiles))
+	for _, protoFile := range i.protoFiles {
+		comments, err := file.ParseProtoFile(protoFile)
+		if err != nil {
+			return fmt.Errorf("file.ParseProtoFile is failed, err: %v", err)
+		}
+		protoComments[protoFile] = comments
+	}
+	i.protoComments = protoComments
+	return nil
+}
+
+// parseFile 解析文件, 设置了 proto 源文件时, 字段的注释以匹配到的 proto 文件为准
+// 没有匹配到 proto 文件时(如: 非 protoc 生成的文件), 仍然使用 go 源码中的注释
+func (i *injector) parseFile(filename string) ([]file.TextArea, error) {
+	if len(i.protoFiles) == 0 {
+		areas, err := file.ParseFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("file.ParseFile is failed, err: %v", err)
+		}
+		return areas, nil
+	}
+
+	src, err := file.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("file.ReadFile is failed, err: %v", err)
+	}
+	return i.parseSrc(filename, src)
+}
+
+// parseSrc 解析源码, 设置了 proto 源文件时, 字段的注释以匹配到的 proto 文件为准
+func (i *injector) parseSrc(filename string, src []byte) ([]file.TextArea, error) {
+	var comments []file.FieldComments
+	if len(i.protoFiles) > 0 {
+		if protoFile, ok := file.MatchProto(filename, src, i.protoFiles); ok {
+			log.Infof("file %q uses the comments in %q", filename, protoFile)
+			comments = append(comments, i.protoComments[protoFile])
+		} else {
+			log.Warningf("file %q is not matched any proto file, it uses the comments in go source", filename)
+		}
+	}
+	areas, err := file.ParseSrc(filename, src, comments...)
+	if err != nil {
+		return nil, fmt.Errorf("file.ParseSrc is failed, err: %v", err)
+	}
+	return areas, nil
+}
+
+// handleFile 处理单个文件
+func (i *injector) handleFile(filename string) (res fileResult) {
+	res.filename = filename
+	res.status = statusUnchanged
+
+	log.Infof("parsing file %q for inject tag comments", filename)
+	areas, err := i.parseFile(filename)
+	if err != nil {
+		res.status, res.err = statusError, err
+		return
+	}
+	// log.Infof("areas: %+v", areas)
+	for _, area := range areas {
+		if err := area.CheckValid(); err != nil {
+			res.invalids = append(res.invalids, fmt.Sprintf("%s:%d: field %q %v", filename, area.Line, strings.Join(area.FieldNames, ", "), err))
+		}
+	}
+	if i.strict && len(res.invalids) > 0 {
+		res.status, res.err = statusError, fmt.Errorf("it has %d invalid valid rules", len(res.invalids))
+		return
+	}
+
+	for _, area := range areas {
+		if area.IsInjected() {
+			continue
+		}
+		for _, name := range area.FieldNames {
+			res.changes = append(res.changes, tagChange{
+				File:      filename,
+				Struct:    area.StructName,
+				Field:     name,
+				Line:      area.Line,
+				OldTag:    area.CurrentTag,
+				InjectTag: area.InjectTag,
+				FinalTag:  area.FinalTag(),
+			})
+		}
+	}
+
+	if i.companion {
+		res = i.handleGenFile(res, areas, companionFile)
+	} else {
+		res = i.handleSource(res, areas)
+	}
+	if i.genValidate && res.status != statusError {
+		res = i.handleGenFile(res, areas, validateFile)
+	}
+	return
+}
+
+// handleSource 将 tag 注入到源文件
+func (i *injector) handleSource(res fileResult, areas []file.TextArea) fileResult {
+	filename := res.filename
+	if i.check {
+		buf := new(strings.Builder)
+		for _, area := range areas {
+			if area.IsInjected() {
+				continue
+			}
+			for _, name := range area.FieldNames {
+				res.missing++
+				fmt.Fprintf(buf, "%s:%d: field %q is missing inject tag [%s]\n", filename, area.Line, name, area.InjectTag)
+			}
+		}
+		if res.missing > 0 {
+			res.status, res.output = statusChanged, buf.String()
+		}
+		return res
+	}
+
+	if i.dryRun {
+		diff, err := file.DiffFile(filename, areas)
+		if err != nil {
+			res.status, res.err = statusError, fmt.Errorf("file.DiffFile is failed, err: %v", err)
+			return res
+		}
+		if diff != "" {
+			res.status, res.output = statusChanged, diff
+		}
+		return res
+	}
+
+	isChanged, err := file.WriteFile(filename, areas, i.backup)
+	if err != nil {
+		res.status, res.err = statusError, fmt.Errorf("file.WriteFile is failed, err: %v", err)
+		return res
+	}
+	if isChanged {
+		res.status = statusChanged
+	}
+	return res
+}
+
+// genFile 根据注入后的 tag 生成的文件
+type genFile struct {
+	name  string                                                        // 文件的说明, 用于输出
+	path  func(inputPath string) string                                 // 生成文件的路径
+	diff  func(inputPath string, areas []file.TextArea) (string, error) // 获取生成前后的 diff
+	write func(inputPath string, areas []file.TextArea) (bool, error)   // 写生成的文件
+}
+
+var (
+	companionFile = genFile{name: "companion", path: file.CompanionPath, diff: file.DiffCompanion, write: file.WriteCompanion}
+	validateFile  = genFile{name: "validate", path: file.ValidatePath, diff: file.DiffValidate, write: file.WriteValidate}
+)
+
+// handleGenFile 处理生成的文件, 源文件保持不变, 结果会合并到 res 中
+func (i *injector) handleGenFile(res fileResult, areas []file.TextArea, gen genFile) fileResult {
+	if i.check || i.dryRun {
+		diff, err := gen.diff(res.filename, areas)
+		if err != nil {
+			res.status, res.err = statusError, fmt.Errorf("generate %s file is failed, err: %v", gen.name, err)
+			return res
+		}
+		if diff == "" {
+			return res
+		}
+		res.status = statusChanged
+		if i.check {
+			res.missing++
+			res.output += fmt.Sprintf("%s: %s file %q is out of date\n", res.filename, gen.name, gen.path(res.filename))
+		} else {
+			res.output += diff
+		}
+		return res
+	}
+
+	isChanged, err := gen.write(res.filename, areas)
+	if err != nil {
+		res.status, res.err = statusError, fmt.Errorf("write %s file is failed, err: %v", gen.name, err)
+		return res
+	}
+	if isChanged {
+		res.status = statusChanged
+	}
+	return res
+}
+
+// injectStdin 从 r 读取 go 源码, 注入后写到 w, 不读写文件, 用于编辑器/构建工具的过滤器
+// 设置了 proto 源文件时按生成文件头部的 source 匹配; strict 时存在不合法的验证规则会报错, 不会输出
+func (i *injector) injectStdin(r io.Reader, w io.Writer) error {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("read stdin is failed, err: %v", err)
+	}
+	if err := i.loadProtos(); err != nil {
+		return err
+	}
+
+	areas, err := i.parseSrc(stdinFilename, src)
+	if err != nil {
+		return err
+	}
+	var invalidNum int
+	for _, area := range areas {
+		if err := area.CheckValid(); err != nil {
+			invalidNum++
+			invalid := fmt.Sprintf("%s:%d: field %q %v", stdinFilename, area.Line, strings.Join(area.FieldNames, ", "), err)
+			if i.strict {
+				log.Error(invalid)
+				continue
+			}
+			log.Warning(invalid)
+		}
+	}
+	if i.strict && invalidNum > 0 {
+		return fmt.Errorf("it has %d invalid valid rules", invalidNum)
+	}
+
+	_, err = w.Write(file.Inject(src, areas))
+	return err
+}
+
+// report 按顺序输出每个文件的处理结果, 并汇总
+func (i *injector) report(results []fileResult) {
+	var changes []tagChange
+	for _, res := range results {
+		i.summary.scanned++
+		if i.reportFormat != reportJson {
+			fmt.Print(res.output)
+		}
+		i.summary.invalid += len(res.invalids)
+		for _, invalid := range res.invalids {
+			if i.strict {
+				log.Error(invalid)
+				continue
+			}
+			log.Warning(invalid)
+		}
+		switch res.status {
+		case statusError:
+			i.summary.failed++
+			log.Errorf("file: %q is %s, %v", res.filename, res.status, res.err)
+			continue
+		case statusChanged:
+			i.summary.changed++
+		}
+		i.summary.missing += res.missing
+		changes = append(changes, res.changes...)
+		log.Infof("file: %q is %s", res.filename, res.status)
+	}
+
+	if i.reportFormat == reportJson {
+		i.printJsonReport(changes)
+	}
+
+	if i.check {
+		log.Infof("check summary, scanned: %d, missing files: %d, missing fields: %d, failed: %d, invalid: %d", i.summary.scanned, i.summary.changed, i.summary.missing, i.summary.failed, i.summary.invalid)
+		return
+	}
+	log.Infof("inject summary, scanned: %d, changed: %d, unchanged: %d, failed: %d, invalid: %d", i.summary.scanned, i.summary.changed, i.summary.scanned-i.summary.changed-i.summary.failed, i.summary.failed, i.summary.invalid)
+}
+
+// printJsonReport 以 json 格式输出字段的变更和汇总
+func (i *injector) printJsonReport(changes []tagChange) {
+	report := jsonReport{Changes: changes}
+	if report.Changes == nil {
+		report.Changes = []tagChange{}
+	}
+	report.Summary.Scanned = i.summary.scanned
+	report.Summary.Changed = i.summary.changed
+	report.Summary.Unchanged = i.summary.scanned - i.summary.changed - i.summary.failed
+	report.Summary.Failed = i.summary.failed
+	report.Summary.Missing = i.summary.missing
+	report.Summary.Invalid = i.summary.invalid
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Error("json.MarshalIndent is failed, err: ", err)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// isFailed 是否需要以非 0 退出
+func (i *injector) isFailed() bool {
+	return i.summary.failed > 0 || i.summary.missing > 0
+}
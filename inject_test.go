@@ -0,0 +1,267 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeTree 在 dir 下按相对路径创建文件
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// relPaths 将 paths 转为相对于 dir 的路径并排序, 便于比较
+func relPaths(t *testing.T, dir string, paths []string) []string {
+	t.Helper()
+	res := make([]string, 0, len(paths))
+	for _, path := range paths {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, filepath.ToSlash(rel))
+	}
+	sort.Strings(res)
+	return res
+}
+
+func TestMatchGlobs(t *testing.T) {
+	tests := []struct {
+		globs []string
+		path  string
+		sure  bool
+	}{
+		{globs: []string{"vendor"}, path: "a/vendor", sure: true},
+		{globs: []string{"vendor/"}, path: "a/vendor", sure: true},
+		{globs: []string{"vendor/"}, path: "vendor", sure: true},
+		{globs: []string{"a/vendor/"}, path: "a/vendor", sure: true},
+		{globs: []string{"*.pb.go"}, path: "a/test.pb.go", sure: true},
+		{globs: []string{"a/*.go"}, path: "a/test.go", sure: true},
+		{globs: []string{"/"}, path: "a", sure: false},
+		{globs: []string{"vendor/"}, path: "a/vendors", sure: false},
+		{globs: nil, path: "a", sure: false},
+	}
+	for _, test := range tests {
+		if got := matchGlobs(test.globs, test.path); got != test.sure {
+			t.Errorf("matchGlobs(%v, %q) = %v, sure: %v", test.globs, test.path, got, test.sure)
+		}
+	}
+}
+
+func TestCollectDir(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a.pb.go":                 "package a",
+		"a_valid.go":              "// Code generated by protoc-go-valid. DO NOT EDIT.\n\npackage a",
+		"a_validate.go":           "// Code generated by protoc-go-valid. DO NOT EDIT.\n\npackage a",
+		"b_valid.go":              "package a",
+		"a.txt":                   "",
+		"sub/b.pb.go":             "package sub",
+		"sub/b.go":                "package sub",
+		"sub/vendor/c.pb.go":      "package vendor",
+		"sub/testdata/d.pb.go":    "package testdata",
+		"sub/deep/testdata/e.go":  "package testdata",
+		"sub/deep/f.pb.go":        "package deep",
+		"vendor/github.com/g.go":  "package g",
+		"testdata/h.pb.go":        "package testdata",
+		"sub/deep/vendor/i.pb.go": "package vendor",
+	})
+
+	tests := []struct {
+		name      string
+		recursive bool
+		includes  []string
+		excludes  []string
+		sure      []string
+	}{
+		{
+			name: "not recursive",
+			sure: []string{"a.pb.go", "b_valid.go"}, // 只跳过生成的 xxx_valid.go 和 xxx_validate.go
+		},
+		{
+			name:      "recursive",
+			recursive: true,
+			includes:  []string{"*.pb.go"},
+			sure: []string{
+				"a.pb.go", "sub/b.pb.go", "sub/deep/f.pb.go", "sub/deep/vendor/i.pb.go",
+				"sub/testdata/d.pb.go", "sub/vendor/c.pb.go", "testdata/h.pb.go",
+			},
+		},
+		{
+			name:      "exclude dir with slash",
+			recursive: true,
+			includes:  []string{"*.pb.go"},
+			excludes:  []string{"vendor/", "testdata/"},
+			sure:      []string{"a.pb.go", "sub/b.pb.go", "sub/deep/f.pb.go"},
+		},
+		{
+			name:      "exclude dir",
+			recursive: true,
+			excludes:  []string{"sub", "vendor"},
+			sure:      []string{"a.pb.go", "b_valid.go", "testdata/h.pb.go"},
+		},
+	}
+	for _, test := range tests {
+		inject := &injector{recursive: test.recursive, includes: test.includes, excludes: test.excludes}
+		filenames, err := inject.collectDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := relPaths(t, dir, filenames); !reflect.DeepEqual(got, test.sure) {
+			t.Errorf("%s: got %v, sure: %v", test.name, got, test.sure)
+		}
+	}
+}
+
+func TestCollectPackages(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod":                      "module example.com/tmp\n\ngo 1.16\n",
+		"a.go":                        "package tmp\n",
+		"a_test.go":                   "package tmp\n",
+		"a_valid.go":                  "// Code generated by protoc-go-valid. DO NOT EDIT.\n\npackage tmp\n",
+		"integration.go":              "//go:build integration\n// +build integration\n\npackage tmp\n",
+		"api/b.pb.go":                 "package api\n",
+		"api/b_linux_test.go":         "package api\n",
+		"api/v1/c.pb.go":              "package v1\n",
+		"api/testdata/d.go":           "package testdata\n",
+		"vendor/example.com/e/e.go":   "package e\n",
+		"_old/f.go":                   "package old\n",
+		".cache/g.go":                 "package cache\n",
+		"doc/README.md":               "",
+		"ignore/h.go":                 "//go:build ignore\n// +build ignore\n\npackage ignore\n",
+		"api/v1/internal/gen/i.pb.go": "package gen\n",
+	})
+
+	tests := []struct {
+		name      string
+		patterns  []string
+		buildTags []string
+		excludes  []string
+		sure      []string
+		hasErr    bool
+	}{
+		{
+			name:     "recursive",
+			patterns: []string{dir + "/..."},
+			sure:     []string{"a.go", "api/b.pb.go", "api/v1/c.pb.go", "api/v1/internal/gen/i.pb.go"},
+		},
+		{
+			name:      "build tags",
+			patterns:  []string{dir + "/..."},
+			buildTags: []string{"integration"},
+			sure:      []string{"a.go", "api/b.pb.go", "api/v1/c.pb.go", "api/v1/internal/gen/i.pb.go", "integration.go"},
+		},
+		{
+			name:     "exclude",
+			patterns: []string{dir + "/api/..."},
+			excludes: []string{"internal/"},
+			sure:     []string{"api/b.pb.go", "api/v1/c.pb.go"},
+		},
+		{
+			name:     "package",
+			patterns: []string{dir, filepath.Join(dir, "api")},
+			sure:     []string{"a.go", "api/b.pb.go"},
+		},
+		{
+			name:     "package without go files",
+			patterns: []string{filepath.Join(dir, "doc")},
+			hasErr:   true,
+		},
+	}
+	for _, test := range tests {
+		inject := &injector{buildTags: test.buildTags, excludes: test.excludes}
+		filenames, err := inject.collectPackages(test.patterns)
+		if test.hasErr {
+			if err == nil {
+				t.Errorf("%s: it should be failed", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := relPaths(t, dir, filenames); !reflect.DeepEqual(got, test.sure) {
+			t.Errorf("%s: got %v, sure: %v", test.name, got, test.sure)
+		}
+	}
+}
+
+func TestInjectStdin(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"proto/user.proto": "syntax = \"proto3\";\n\nmessage User {\n  string name = 1; // @tag valid:\"required\"\n}\n",
+	})
+	src := "// Code generated by protoc-gen-go. DO NOT EDIT.\n// source: proto/user.proto\n\npackage user\n\n" +
+		"type User struct {\n\tName string `json:\"name,omitempty\"` // @tag valid:\"notexist\"\n}\n"
+
+	tests := []struct {
+		name   string
+		inject *injector
+		sure   string
+		hasErr bool
+	}{
+		{
+			name:   "go source",
+			inject: &injector{},
+			sure:   strings.Replace(src, "`json:\"name,omitempty\"`", "`json:\"name,omitempty\" valid:\"notexist\"`", 1),
+		},
+		{
+			name:   "strict",
+			inject: &injector{strict: true},
+			hasErr: true,
+		},
+		{
+			name:   "proto",
+			inject: &injector{strict: true, protoFiles: []string{filepath.Join(dir, "proto/user.proto")}},
+			sure:   strings.Replace(src, "`json:\"name,omitempty\"`", "`json:\"name,omitempty\" valid:\"required\"`", 1),
+		},
+	}
+	for _, test := range tests {
+		buf := new(strings.Builder)
+		err := test.inject.injectStdin(strings.NewReader(src), buf)
+		if test.hasErr {
+			if err == nil || buf.Len() > 0 {
+				t.Errorf("%s: it should be failed without output", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if buf.String() != test.sure {
+			t.Errorf("%s: %s", test.name, buf.String())
+		}
+	}
+}
+
+func TestHandleFileMultiNames(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "user.pb.go")
+	writeTree(t, dir, map[string]string{
+		"user.pb.go": "package user\n\ntype User struct {\n\tA, B string // @tag valid:\"required\"\n}\n",
+	})
+
+	// 一行声明多个字段时, 每个字段都会输出
+	res := (&injector{check: true}).handleFile(filename)
+	if res.missing != 2 || !strings.Contains(res.output, `field "A"`) || !strings.Contains(res.output, `field "B"`) {
+		t.Errorf("missing: %d, output: %s", res.missing, res.output)
+	}
+	if len(res.changes) != 2 || res.changes[0].Field != "A" || res.changes[1].Field != "B" {
+		t.Errorf("changes: %+v", res.changes)
+	}
+}
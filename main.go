@@ -3,10 +3,11 @@ package main
 import (
 	"bytes"
 	"flag"
+	"fmt"
 	"io/fs"
 	"os"
-	"path/filepath"
-	"strings"
+	"runtime"
+	"time"
 
 	"gitee.com/xuesongtao/protoc-go-valid/file"
 	"gitee.com/xuesongtao/protoc-go-valid/log"
@@ -47,76 +48,68 @@ func createInjectToolSh(template, create, old, new string) error {
 	return os.WriteFile(create, bytes.ReplaceAll(contentByte, []byte(old), []byte(new)), fs.ModePerm)
 }
 
-// handleDir 按目录处理
-func handleDir(dirPath string) (isHasMatch bool) {
-	dirs, err := os.ReadDir(dirPath)
-	if err != nil {
-		log.Error("os.ReadDir is failed, err: ", err)
-		return
-	}
+// stdinUnsupportedFlags 不能和 -stdin 一起使用的参数, -stdin 只从 stdin 读取并输出到 stdout
+var stdinUnsupportedFlags = []string{"d", "r", "p", "f", "include", "exclude", "tags", "dry-run", "check", "backup", "companion", "gen-validate", "report", "watch", "interval", "j"}
 
-	dirPath = file.HandlePath(dirPath)
-	for _, dir := range dirs {
-		if dir.IsDir() {
-			continue
+// checkStdinFlags 检查 -stdin 是否和不支持的参数一起使用
+func checkStdinFlags() error {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, name := range stdinUnsupportedFlags {
+		if set[name] {
+			return fmt.Errorf("-stdin can not be used with -%s", name)
 		}
-		isHasMatch = true
-
-		filename := dirPath + dir.Name()
-		_ = handleFile(filename)
 	}
-	return
-}
-
-// handlePatternFiles 根据路径表达式处理
-func handlePatternFiles(pattern string) (isHasMatch bool) {
-	filenames, err := filepath.Glob(pattern)
-	if err != nil {
-		log.Error("filepath.Glob is failed, err: ", err)
-		return
-	}
-
-	for _, filename := range filenames {
-		isHasMatch = true
-		_ = handleFile(filename)
+	if flag.NArg() > 0 {
+		return fmt.Errorf("-stdin can not be used with packages %v", flag.Args())
 	}
-	return
+	return nil
 }
 
-// handleFile 处理单个文件
-func handleFile(filename string) (isHasMatch bool) {
-	// 只处理 .go 文件
-	if !strings.HasSuffix(filename, ".go") {
-		return
-	}
-	isHasMatch = true
-
-	log.Infof("parsing file %q for inject tag comments", filename)
-	areas, err := file.ParseFile(filename)
-	if err != nil {
-		log.Error("file.ParseFile is failed, err: ", err)
-		return
-	}
-	// log.Infof("areas: %+v", areas)
-
-	if err = file.WriteFile(filename, areas); err != nil {
-		log.Error("file.WriteFile is failed, err: ", err)
+func main() {
+	// gen 子命令根据项目配置文件执行 protoc 和注入
+	if len(os.Args) > 1 && os.Args[1] == "gen" {
+		runGen(os.Args[2:])
 		return
 	}
-	log.Infof("file: %q is inject tag is success", filename)
-	return
-}
 
-func main() {
 	var (
-		initProject                       bool
+		initProject, recursive            bool
+		dryRun, check, backup, stdin      bool
+		watch, strict, companion          bool
+		genValidate                       bool
 		inputDir, inputPattern, inputFile string
+		includes, excludes, merge         string
+		buildTags, report, allowValid     string
+		protoFiles, markers, macroFiles   string
+		jobs                              int
+		interval                          time.Duration
 	)
 
 	flag.BoolVar(&initProject, "init", false, "是否初始化项目, 如: protoc-go-valid -init=\"true\"")
 	flag.StringVar(&inputDir, "d", "", "注入的目录, 如: protoc-go-valid -d \"./proto\"")
+	flag.BoolVar(&recursive, "r", false, "配合 -d 使用, 递归处理所有子目录, 如: protoc-go-valid -r -d \"./protogo\"")
 	flag.StringVar(&inputPattern, "p", "", "注入匹配到的多个文件, 如: protoc-go-valid -p \"./*.pb.go\"")
 	flag.StringVar(&inputFile, "f", "", "注入的单个文件, 如: protoc-go-valid -f \"xxx.pb.go\"")
+	flag.StringVar(&includes, "include", "", "需要处理的文件匹配规则, 多个通过逗号隔开, 如: protoc-go-valid -include \"*.pb.go\"")
+	flag.StringVar(&excludes, "exclude", "", "需要跳过的文件/目录匹配规则, 多个通过逗号隔开, 如: protoc-go-valid -exclude \"vendor,testdata\"")
+	flag.BoolVar(&dryRun, "dry-run", false, "只输出注入前后的 unified diff, 不写文件, 如: protoc-go-valid -dry-run -f \"xxx.pb.go\"")
+	flag.BoolVar(&check, "check", false, "检查 @tag 是否都已注入, 不写文件, 有未注入的字段时以非 0 退出, 如: protoc-go-valid -check -r -d \"./protogo\"")
+	flag.StringVar(&buildTags, "tags", "", "按包处理时的构建标签, 多个通过逗号隔开, 如: protoc-go-valid -tags \"integration\" ./api/...")
+	flag.StringVar(&report, "report", "", "处理结果的输出格式, 目前只支持 json, 会输出每个字段的变更, 如: protoc-go-valid -report=json -r -d \"./protogo\"")
+	flag.BoolVar(&watch, "watch", false, "持续监听文件变化并重新注入, 按 ctrl+c 退出, 如: protoc-go-valid -watch -d \"./protogo\"")
+	flag.DurationVar(&interval, "interval", time.Second, "配合 -watch 使用, 检查文件变化的间隔, 如: protoc-go-valid -watch -interval 500ms -d \"./protogo\"")
+	flag.StringVar(&allowValid, "allow-valid", "", "自定义验证名白名单, 多个通过逗号隔开, 注入时会校验 valid 中的规则是否存在, 如: protoc-go-valid -allow-valid \"mobile,sex\" -f \"xxx.pb.go\"")
+	flag.BoolVar(&strict, "strict", false, "存在不合法的验证规则时, 文件按处理失败处理, 不会写文件且以非 0 退出, 如: protoc-go-valid -strict -f \"xxx.pb.go\"")
+	flag.BoolVar(&companion, "companion", false, "不修改源文件, 生成伴生文件 xxx_valid.go 在 init 中注册规则, 如: protoc-go-valid -companion -f \"xxx.pb.go\"")
+	flag.StringVar(&protoFiles, "proto", "", "proto 源文件, 多个通过逗号隔开, 支持通配符, 字段的注释以 proto 文件为准, 如: protoc-go-valid -proto \"./proto/*.proto\" -d \"./protogo\"")
+	flag.StringVar(&markers, "marker", "", "注释中注入 tag 的标识, 多个通过逗号隔开, 会替换默认的 @tag, 标识=key 为简写, 如: protoc-go-valid -marker \"@inject,@valid=valid\" -f \"xxx.pb.go\"")
+	flag.StringVar(&macroFiles, "macro", "", "规则宏文件, 多个通过逗号隔开, 每行为: 宏名 = 规则, 注释中通过 valid:\"$宏名\" 引用, 如: protoc-go-valid -macro \"valid.macro\" -f \"xxx.pb.go\"")
+	flag.BoolVar(&genValidate, "gen-validate", false, "额外生成 xxx_validate.go, 包含不依赖反射的 Validate 方法, 如: protoc-go-valid -gen-validate -f \"xxx.pb.go\"")
+	flag.BoolVar(&backup, "backup", false, "写文件前将原内容备份为 xxx.orig, 如: protoc-go-valid -backup -f \"xxx.pb.go\"")
+	flag.BoolVar(&stdin, "stdin", false, "从 stdin 读取 go 源码, 注入后输出到 stdout, 不读写文件, 支持 -proto 和 -strict, 如: protoc-go-valid -stdin < xxx.pb.go")
+	flag.StringVar(&merge, "merge", "", "key 重复时的合并策略(replace/append/union), 默认为 replace, 如: protoc-go-valid -merge \"union\" 或 -merge \"valid=union,json=replace\"")
+	flag.IntVar(&jobs, "j", runtime.NumCPU(), "并发处理的文件数, 如: protoc-go-valid -j 8 -r -d \"./protogo\"")
 	flag.Parse()
 
 	// 判断是否初始化
@@ -125,16 +118,87 @@ func main() {
 		return
 	}
 
-	var isHasMatch bool
-	if inputDir != "" {
-		isHasMatch = handleDir(inputDir)
-	} else if inputPattern != "" {
-		isHasMatch = handlePatternFiles(inputPattern)
-	} else {
-		isHasMatch = handleFile(inputFile)
+	if err := file.SetMergePolicy(merge); err != nil {
+		log.Fatal("file.SetMergePolicy is failed, err: ", err)
+	}
+
+	if markers != "" {
+		if err := file.SetMarkers(splitGlobs(markers)...); err != nil {
+			log.Fatal("file.SetMarkers is failed, err: ", err)
+		}
+	}
+
+	for _, macroFile := range splitGlobs(macroFiles) {
+		if err := file.LoadMacroFile(macroFile); err != nil {
+			log.Fatal("file.LoadMacroFile is failed, err: ", err)
+		}
+	}
+
+	file.SetAllowValidNames(splitGlobs(allowValid)...)
+
+	if report != "" && report != reportJson {
+		log.Fatalf("report %q is not supported, it should be json", report)
+	}
+
+	protos, err := expandGlobs(splitGlobs(protoFiles))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	inject := &injector{
+		recursive:    recursive,
+		dryRun:       dryRun,
+		check:        check,
+		backup:       backup,
+		companion:    companion,
+		genValidate:  genValidate,
+		jobs:         jobs,
+		includes:     splitGlobs(includes),
+		excludes:     splitGlobs(excludes),
+		buildTags:    splitGlobs(buildTags),
+		strict:       strict,
+		reportFormat: report,
+		protoFiles:   protos,
+	}
+	if stdin {
+		if err := checkStdinFlags(); err != nil {
+			log.Fatal(err)
+		}
+		if err := inject.injectStdin(os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	collect := func() (filenames []string, err error) {
+		if inputDir != "" {
+			return inject.collectDir(inputDir)
+		}
+		if inputPattern != "" {
+			return inject.collectPatternFiles(inputPattern)
+		}
+		if flag.NArg() > 0 {
+			return inject.collectPackages(flag.Args())
+		}
+		return inject.collectFile(inputFile), nil
+	}
+
+	if watch {
+		inject.watch(collect, interval)
+		return
+	}
+
+	filenames, err := collect()
+	if err != nil {
+		log.Fatal("collect files is failed, err: ", err)
 	}
 
-	if !isHasMatch {
+	if len(filenames) == 0 {
 		log.Error("it is not matched files, see: -help")
+		os.Exit(1)
+	}
+	inject.report(inject.run(filenames))
+	if inject.isFailed() {
+		os.Exit(1)
 	}
 }
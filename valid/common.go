@@ -330,6 +330,51 @@ func ToStr(src interface{}) string {
 	}
 }
 
+// StructRulesSplit 结构体级别的规则进行分割, 括号内的逗号不会分割
+// 如: "either(OrderNo,TradeNo),botheq(Pwd,RePwd)" => ["either(OrderNo,TradeNo)", "botheq(Pwd,RePwd)"]
+func StructRulesSplit(s string) []string {
+	res := make([]string, 0, 2)
+	var depth, start int
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				res = append(res, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(res, strings.TrimSpace(s[start:]))
+}
+
+// ParseStructRule 解析结构体级别的规则, 如: "either(OrderNo,TradeNo)", validName 为 "either", fieldNames 为 ["OrderNo", "TradeNo"]
+// 目前只支持 either 和 botheq
+func ParseStructRule(rule string) (validName string, fieldNames []string, err error) {
+	leftIndex := strings.IndexByte(rule, '(')
+	if leftIndex == -1 || !strings.HasSuffix(rule, ")") {
+		return "", nil, structRuleValErr
+	}
+
+	validName = rule[:leftIndex]
+	if validName != Either && validName != BothEq {
+		return "", nil, structRuleValErr
+	}
+
+	for _, fieldName := range strings.Split(rule[leftIndex+1:len(rule)-1], ",") {
+		if fieldName = strings.TrimSpace(fieldName); fieldName != "" {
+			fieldNames = append(fieldNames, fieldName)
+		}
+	}
+	if len(fieldNames) < 2 {
+		return "", nil, structRuleValErr
+	}
+	return
+}
+
 // ValidNamesSplit 验证点进行分割
 // 会按给定 sep(默认 ",") 进行分割, 如果遇到被 '' 进行包裹的内容会跳过
 func ValidNamesSplit(s string, sep ...byte) []string {
@@ -44,6 +44,24 @@ func TestValidNamesSplit(t *testing.T) {
 	t.Log(ValidNamesSplit("required|必填,phone|'手机号码必填,同时正确',re='\\d+{1,2}'"))
 }
 
+func TestParseStructRule(t *testing.T) {
+	rules := StructRulesSplit("either(OrderNo,TradeNo), botheq(Pwd,RePwd)")
+	if !reflect.DeepEqual(rules, []string{"either(OrderNo,TradeNo)", "botheq(Pwd,RePwd)"}) {
+		t.Errorf("split is failed: %q", rules)
+	}
+
+	validName, fieldNames, err := ParseStructRule(rules[0])
+	if err != nil || validName != Either || !reflect.DeepEqual(fieldNames, []string{"OrderNo", "TradeNo"}) {
+		t.Errorf("parse is failed, validName: %q, fieldNames: %q, err: %v", validName, fieldNames, err)
+	}
+
+	for _, rule := range []string{"required(A,B)", "either(A)", "either"} {
+		if _, _, err := ParseStructRule(rule); err == nil {
+			t.Errorf("%q should be failed", rule)
+		}
+	}
+}
+
 func TestLRU(t *testing.T) {
 	var wg sync.WaitGroup
 	size := 3
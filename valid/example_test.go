@@ -618,3 +618,30 @@ func ExampleGetOnlyExplainErr() {
 	// OutPut:
 	// 姓名长度应该在2-4个长度; IntString请输入整数类; IntNum请输入整数
 }
+
+func ExampleStructRuleField() {
+	type Tmp struct {
+		OrderNo string
+		TradeNo string
+		Pwd     string
+		RePwd   string
+		_       struct{} `valid:"either(OrderNo,TradeNo),botheq(Pwd,RePwd)"`
+	}
+	v := &Tmp{Pwd: "123", RePwd: "123"}
+	fmt.Println(Struct(v))
+
+	// Output:
+	// "Tmp.OrderNo", "Tmp.TradeNo" explain: they shouldn't all be empty
+}
+
+func ExampleSetGlobalRule() {
+	type Tmp struct {
+		Name string
+		Age  int
+	}
+	SetGlobalRule(RM{"Name": "required", "Age": "ge=1"}, (*Tmp)(nil))
+	fmt.Println(Struct(&Tmp{Age: -1}))
+
+	// Output:
+	// "Tmp.Name" input "", explain: it is required; "Tmp.Age" input "-1", explain: it is less than 1 num-size
+}
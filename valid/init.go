@@ -133,7 +133,9 @@ var (
 // 标记
 var (
 	defaultTargetTag = "valid" // 默认的验证 tag
+	StructRuleField  = "_"     // 结构体级别的规则所在的字段名, 如: _ struct{} `valid:"either(OrderNo,TradeNo)"`
 	ErrEndFlag       = "; "    // 错误结束符号(每个自定义 err 都需要将这个追加在后面, 用于分句)
+	NoRule           = "-"     // 通过 SetRule/SetGlobalRule 设置为此值时, 字段没有验证规则, 会忽略 tag 中的规则
 )
 
 // 错误
@@ -154,6 +156,13 @@ var (
 		"    TradeNo sting `valid:\"either=1\"`\n" +
 		"}, errMsg: \"OrderNo\" either \"TradeNo\" they shouldn't all be empty")
 
+	structRuleValErr = errors.New(defaultTargetTag + " struct rule is not ok, eg: " +
+		"type Test struct {\n" +
+		"    OrderNo string\n" +
+		"    TradeNo string\n" +
+		"    _       struct{} `valid:\"either(OrderNo,TradeNo)\"`\n" +
+		"}, it only supports either/botheq")
+
 	bothEqValErr = errors.New(defaultTargetTag + " \"botheq\" is not ok, eg: " +
 		"type Test struct {\n" +
 		"    OrderNo string `valid:\"botheq=1\"`\n" +
@@ -238,6 +247,12 @@ func SetCustomerValidFn(validName string, fn CommonValidFn) {
 	validName2FnMap[validName] = fn
 }
 
+// ExistValidName 判断全局是否存在该验证名, 包括内置的和通过 SetCustomerValidFn 添加的
+func ExistValidName(validName string) bool {
+	_, ok := validName2FnMap[validName]
+	return ok
+}
+
 // SetStructTypeCache 设置 structType 缓存类型
 func SetStructTypeCache(cacheEr CacheEr) {
 	once.Do(func() {
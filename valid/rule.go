@@ -1,6 +1,14 @@
 package valid
 
-import "strings"
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	globalRules sync.Map // 全局的验证规则, key 为结构体 reflect.Type, value 为 RM
+)
 
 // RM 字段的自定义验证规则, key 为字段名, value 为验证规则
 type RM map[string]string
@@ -32,6 +40,28 @@ func (r RM) Get(fieldName string) string {
 	return r[fieldName]
 }
 
+// SetGlobalRule 为结构体设置全局的验证规则, 一般在 init 中调用, 如: 工具生成的 xxx_valid.go
+// 优先级低于 VStruct.SetRule, 高于 tag 中的规则
+func SetGlobalRule(rule RM, obj interface{}) {
+	if obj == nil {
+		return
+	}
+	ty := RemoveTypePtr(reflect.TypeOf(obj))
+	if ty.Kind() != reflect.Struct {
+		return
+	}
+	globalRules.Store(ty, rule)
+}
+
+// getGlobalRule 获取结构体全局的验证规则
+func getGlobalRule(ty reflect.Type) RM {
+	rule, ok := globalRules.Load(ty)
+	if !ok {
+		return nil
+	}
+	return rule.(RM)
+}
+
 // Deprecated: 名字存在歧义, 因为已上线不能删除, 特此标记, 推荐使用 GenValidKV
 // JoinTag2Val 生成 defaultTargetTag 的值
 func JoinTag2Val(key string, values ...string) string {
@@ -1,6 +1,9 @@
 package valid
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestRule(t *testing.T) {
 	r := NewRule().Set("Name,Age", Required, "eq=3", "le=1").Set("Age", "int", "test")
@@ -27,6 +30,57 @@ func TestRuleValid(t *testing.T) {
 	}
 }
 
+func TestGlobalRuleWithSetRule(t *testing.T) {
+	type Tmp struct {
+		Name    string `valid:"required"`
+		Age     int    `valid:"ge=1"`
+		Addr    string
+		OrderNo string
+		TradeNo string
+		_       struct{} `valid:"either(OrderNo,TradeNo)"`
+	}
+	SetGlobalRule(RM{"Age": "ge=10", "Addr": "required", StructRuleField: "botheq(OrderNo,TradeNo)"}, (*Tmp)(nil))
+	defer globalRules.Delete(reflect.TypeOf(Tmp{}))
+
+	// Name 使用 SetRule, Age 和 Addr 使用全局规则, 结构体规则使用全局规则
+	v := &Tmp{Age: 5, OrderNo: "1"}
+	err := NewVStruct().SetRule(RM{"Name": "le=1"}).Valid(v)
+	sureMsg := `"Tmp.Age" input "5", explain: it is less than 10 num-size; "Tmp.Addr" input "", explain: it is required; "Tmp.OrderNo", "Tmp.TradeNo" explain: they should be equal`
+	if err == nil || !equal(err.Error(), sureMsg) {
+		t.Error(noEqErr, err)
+	}
+
+	// SetRule 设置的结构体规则优先于全局规则
+	v = &Tmp{Name: "xue", Age: 10, Addr: "sz", OrderNo: "1"}
+	if err := NewVStruct().SetRule(RM{StructRuleField: "either(OrderNo,TradeNo)"}).Valid(v); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNoRule(t *testing.T) {
+	type Tmp struct {
+		Name    string `valid:"required"`
+		Age     int    `valid:"ge=1"`
+		OrderNo string
+		TradeNo string
+		_       struct{} `valid:"either(OrderNo,TradeNo)"`
+	}
+	SetGlobalRule(RM{"Name": NoRule, StructRuleField: NoRule}, (*Tmp)(nil))
+	defer globalRules.Delete(reflect.TypeOf(Tmp{}))
+
+	// 全局规则设置为 NoRule 时忽略 tag 中的规则
+	if err := Struct(&Tmp{Age: 1}); err != nil {
+		t.Error(err)
+	}
+
+	// SetRule 优先
+	err := NewVStruct().SetRule(RM{"Age": NoRule, "Name": "required"}).Valid(&Tmp{})
+	sureMsg := `"Tmp.Name" input "", explain: it is required`
+	if err == nil || !equal(err.Error(), sureMsg) {
+		t.Error(noEqErr, err)
+	}
+}
+
 func TestGenValidKV(t *testing.T) {
 	if !equal(GenValidKV(Required, "", "必填"), Required+"|必填") {
 		t.Error(noEqErr)
@@ -20,8 +20,9 @@ type VStruct struct {
 
 // structType 结构体类型
 type structType struct {
-	name       string            // 名字
-	fieldInfos []structFieldInfo // 偏移量对应的字段信息内容
+	name        string            // 名字
+	fieldInfos  []structFieldInfo // 偏移量对应的字段信息内容
+	structRules string            // 结构体级别的规则, 来自字段 _ 的 tag
 }
 
 // structFieldInfo 结构体字段信息
@@ -159,6 +160,8 @@ func (v *VStruct) validate(structName string, value reflect.Value, isValidGather
 	} else {
 		cusRM = v.getCusRule(ty)
 	}
+	// 全局的规则, 按字段的优先级为: SetRule > SetGlobalRule > tag
+	globalRM := getGlobalRule(ty)
 	// fmt.Printf("cusRM: %+v\n", cusRM)
 	for fieldNum := 0; fieldNum < totalFieldNum; fieldNum++ {
 		fieldInfo := cacheStructType.fieldInfos[fieldNum]
@@ -168,7 +171,9 @@ func (v *VStruct) validate(structName string, value reflect.Value, isValidGather
 		}
 
 		// 如果设置了规则就覆盖 tag 中的验证内容
-		if rule := cusRM.Get(fieldInfo.name); rule != "" {
+		if rule := getFieldRule(fieldInfo.name, cusRM, globalRM); rule == NoRule {
+			fieldInfo.validNames = ""
+		} else if rule != "" {
 			fieldInfo.validNames = rule
 		}
 
@@ -184,43 +189,110 @@ func (v *VStruct) validate(structName string, value reflect.Value, isValidGather
 			if validName == "" {
 				continue
 			}
+			v.validField(validName, structName, fieldInfo.name, fieldValue)
+		}
+	}
 
-			validKey, _, cusMsg := ParseValidNameKV(validName)
-			fn, err := v.getValidFn(validKey)
-			if err != nil {
-				v.errBuf.WriteString(GetJoinFieldErr(structName, fieldInfo.name, err))
-				continue
-			}
+	// 结构体级别的规则, 如果设置了规则就覆盖 tag 中的验证内容
+	structRules := cacheStructType.structRules
+	if rule := getFieldRule(StructRuleField, cusRM, globalRM); rule == NoRule {
+		structRules = ""
+	} else if rule != "" {
+		structRules = rule
+	}
+	if structRules != "" {
+		v.validStructRules(structName, tv, structRules)
+	}
+	return v
+}
 
-			// fmt.Printf("structName: %s, structFieldName: %s, tv: %v\n", cacheStructType.name, fieldInfo.name, fieldValue)
-			// 开始验证
-			// VStruct 内的验证方法
-			if fn == nil {
-				switch validKey {
-				case Required:
-					v.required(structName, fieldInfo.name, cusMsg, fieldValue)
-				case Exist:
-					v.exist(true, structName, fieldInfo.name, cusMsg, fieldValue)
-				case Either, BothEq:
-					v.vc.initValid2FieldsMap(&name2Value{
-						validName:  validName,
-						objName:    structName,
-						fieldName:  fieldInfo.name,
-						cusMsg:     cusMsg,
-						reflectVal: fieldValue,
-					})
-				}
-				continue
-			}
+// getFieldRule 按顺序获取字段设置的规则, 前面的优先
+func getFieldRule(fieldName string, rms ...RM) string {
+	for _, rm := range rms {
+		if rule := rm.Get(fieldName); rule != "" {
+			return rule
+		}
+	}
+	return ""
+}
+
+// validField 对字段执行一个验证规则
+func (v *VStruct) validField(validName, structName, fieldName string, fieldValue reflect.Value) {
+	validKey, _, cusMsg := ParseValidNameKV(validName)
+	fn, err := v.getValidFn(validKey)
+	if err != nil {
+		v.errBuf.WriteString(GetJoinFieldErr(structName, fieldName, err))
+		return
+	}
+
+	// fmt.Printf("structName: %s, structFieldName: %s, tv: %v\n", structName, fieldName, fieldValue)
+	// 开始验证
+	// VStruct 内的验证方法
+	if fn == nil {
+		switch validKey {
+		case Required:
+			v.required(structName, fieldName, cusMsg, fieldValue)
+		case Exist:
+			v.exist(true, structName, fieldName, cusMsg, fieldValue)
+		case Either, BothEq:
+			v.vc.initValid2FieldsMap(&name2Value{
+				validName:  validName,
+				objName:    structName,
+				fieldName:  fieldName,
+				cusMsg:     cusMsg,
+				reflectVal: fieldValue,
+			})
+		}
+		return
+	}
+
+	// VStruct 外拓展的验证方法
+	if fieldValue.IsZero() { // 空就直接跳过
+		return
+	}
+	fn(v.errBuf, validName, structName, fieldName, fieldValue)
+}
+
+// ValidField 按 VStruct 的方式对单个字段执行一个验证规则, 错误信息和 VStruct 一致
+// 主要用于工具生成的 Validate 方法中无法直接生成代码的规则, 如: phone, re 等
+func ValidField(errBuf *strings.Builder, validName, objName, fieldName string, val interface{}) {
+	v := NewVStruct()
+	v.validField(validName, objName, fieldName, reflect.ValueOf(val))
+	v.vc.valid(v.errBuf)
+	errBuf.WriteString(v.errBuf.String())
+	v.free()
+}
 
-			// VStruct 外拓展的验证方法
-			if fieldValue.IsZero() { // 空就直接跳过
+// validStructRules 验证结构体级别的规则, 如: either(OrderNo,TradeNo)
+// 会转为和字段上 either=xxx 一样的分组进行验证
+func (v *VStruct) validStructRules(structName string, tv reflect.Value, structRules string) {
+	for _, rule := range StructRulesSplit(structRules) {
+		if rule == "" {
+			continue
+		}
+
+		validName, fieldNames, err := ParseStructRule(rule)
+		if err != nil {
+			v.errBuf.WriteString(GetJoinFieldErr(structName, StructRuleField, err))
+			continue
+		}
+
+		// 分组名需要区分结构体, 避免和字段上的分组冲突
+		groupName := validName + "=" + structName + "(" + strings.Join(fieldNames, ",") + ")"
+		for _, fieldName := range fieldNames {
+			fieldValue := tv.FieldByName(fieldName)
+			if !fieldValue.IsValid() {
+				v.errBuf.WriteString(GetJoinFieldErr(structName, fieldName, "is not exist, struct rule: "+rule))
 				continue
 			}
-			fn(v.errBuf, validName, structName, fieldInfo.name, fieldValue)
+			v.vc.initValid2FieldsMap(&name2Value{
+				validName:  groupName,
+				objName:    structName,
+				fieldName:  fieldName,
+				reflectVal: fieldValue,
+			})
 		}
 	}
-	return v
 }
 
 // getCacheStructType 获取缓存中的 reflect.Type
@@ -237,6 +309,10 @@ func (v *VStruct) getCacheStructType(ty reflect.Type) structType {
 		if fieldInfo.Type == timeReflectType {
 			continue
 		}
+		if fieldInfo.Name == StructRuleField {
+			obj.structRules = fieldInfo.Tag.Get(v.targetTag)
+			continue
+		}
 		info := structFieldInfo{
 			export:     IsExported(fieldInfo.Name),
 			offset:     fieldNum,
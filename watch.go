@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"gitee.com/xuesongtao/protoc-go-valid/log"
+)
+
+// fileState 文件状态, 用于判断文件是否有变化
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// statFile 获取文件状态
+func statFile(filename string) (state fileState, err error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return
+	}
+	state.size, state.modTime = info.Size(), info.ModTime()
+	return
+}
+
+// watch 按 interval 轮询 collect 获取的文件, 只重新注入内容有变化的文件
+// 注入后会记录文件的最新状态, 避免处理自己写入的文件
+func (i *injector) watch(collect func() ([]string, error), interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	log.Infof("watching files, interval: %v", interval)
+
+	states := make(map[string]fileState)
+	for {
+		i.watchOnce(collect, states)
+		time.Sleep(interval)
+	}
+}
+
+// watchOnce 执行一轮检查
+func (i *injector) watchOnce(collect func() ([]string, error), states map[string]fileState) {
+	filenames, err := collect()
+	if err != nil {
+		log.Error("collect files is failed, err: ", err)
+		return
+	}
+
+	// proto 源文件有变化时, 所有文件都需要重新注入
+	exist := make(map[string]bool, len(filenames)+len(i.protoFiles))
+	var protoChanged bool
+	for _, protoFile := range i.protoFiles {
+		exist[protoFile] = true
+		state, err := statFile(protoFile)
+		if err != nil {
+			log.Errorf("stat file %q is failed, err: %v", protoFile, err)
+			continue
+		}
+		if old, ok := states[protoFile]; !ok || old != state {
+			protoChanged = true
+			states[protoFile] = state
+		}
+	}
+
+	// 找到新增或有变化的文件
+	changed := make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		exist[filename] = true
+		state, err := statFile(filename)
+		if err != nil {
+			log.Errorf("stat file %q is failed, err: %v", filename, err)
+			continue
+		}
+		if old, ok := states[filename]; ok && old == state && !protoChanged {
+			continue
+		}
+		changed = append(changed, filename)
+	}
+
+	// 已删除的文件不再跟踪
+	for filename := range states {
+		if !exist[filename] {
+			delete(states, filename)
+		}
+	}
+
+	if len(changed) == 0 {
+		return
+	}
+
+	i.summary = summary{}
+	i.report(i.run(changed))
+
+	// 记录处理后的状态, 下一轮就不会再处理自己写入的文件
+	for _, filename := range changed {
+		if state, err := statFile(filename); err == nil {
+			states[filename] = state
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWatchOnce(t *testing.T) {
+	dir := t.TempDir()
+	protoFile := filepath.Join(dir, "user.proto")
+	src := "package user\n\ntype User struct {\n\tName string // @tag valid:\"required\"\n}\n"
+	writeTree(t, dir, map[string]string{
+		"user.proto": "syntax = \"proto3\";\n",
+		"a.pb.go":    src,
+		"b.pb.go":    "package user\n",
+	})
+	aFile, bFile := filepath.Join(dir, "a.pb.go"), filepath.Join(dir, "b.pb.go")
+
+	inject := &injector{jobs: 1, protoFiles: []string{protoFile}}
+	collect := func() ([]string, error) { return inject.collectDir(dir) }
+	states := make(map[string]fileState)
+	watchOnce := func() summary {
+		inject.summary = summary{}
+		inject.watchOnce(collect, states)
+		return inject.summary
+	}
+
+	// 新增的文件都会处理, 并注入
+	if got := watchOnce(); got.scanned != 2 || got.changed != 1 {
+		t.Errorf("first: %+v", got)
+	}
+	data, err := ioutil.ReadFile(aFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "`valid:\"required\"`") {
+		t.Errorf("a.pb.go is not injected: %s", data)
+	}
+	if _, ok := states[protoFile]; !ok || len(states) != 3 {
+		t.Errorf("states: %v", states)
+	}
+
+	// 没有变化的文件和刚写入的文件都不会再处理
+	if got := watchOnce(); got.scanned != 0 {
+		t.Errorf("unchanged: %+v", got)
+	}
+
+	// 只处理有变化的文件
+	if err := ioutil.WriteFile(bFile, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := watchOnce(); got.scanned != 1 || got.changed != 1 {
+		t.Errorf("changed: %+v", got)
+	}
+
+	// 删除的文件不再跟踪
+	if err := os.Remove(bFile); err != nil {
+		t.Fatal(err)
+	}
+	if got := watchOnce(); got.scanned != 0 {
+		t.Errorf("removed: %+v", got)
+	}
+	if _, ok := states[bFile]; ok {
+		t.Error("removed file should not be tracked")
+	}
+
+	// proto 文件有变化时, 所有文件都重新注入
+	if err := ioutil.WriteFile(protoFile, []byte("syntax = \"proto3\";\n\npackage user;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := watchOnce(); got.scanned != 1 || got.changed != 0 {
+		t.Errorf("proto changed: %+v", got)
+	}
+	if got := watchOnce(); got.scanned != 0 {
+		t.Errorf("proto unchanged: %+v", got)
+	}
+}